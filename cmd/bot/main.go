@@ -6,13 +6,23 @@ import (
 	"os/signal"
 	"syscall"
 
+	"chatgpt-telegram-bot/internal/adapter/anthropic"
 	"chatgpt-telegram-bot/internal/adapter/memory"
 	"chatgpt-telegram-bot/internal/adapter/openai"
+	"chatgpt-telegram-bot/internal/adapter/retry"
+	"chatgpt-telegram-bot/internal/adapter/router"
+	"chatgpt-telegram-bot/internal/adapter/sqlite"
 	"chatgpt-telegram-bot/internal/adapter/telegram"
+	"chatgpt-telegram-bot/internal/adapter/tokenizer"
 	"chatgpt-telegram-bot/internal/config"
+	"chatgpt-telegram-bot/internal/domain"
+	"chatgpt-telegram-bot/internal/tools"
 	"chatgpt-telegram-bot/internal/usecase/chat"
 	"chatgpt-telegram-bot/internal/usecase/image"
+	"chatgpt-telegram-bot/internal/usecase/quota"
+	"chatgpt-telegram-bot/internal/usecase/transcribe"
 	"chatgpt-telegram-bot/internal/usecase/tts"
+	"chatgpt-telegram-bot/internal/usecase/usage"
 )
 
 func main() {
@@ -21,20 +31,42 @@ func main() {
 		log.Fatalf("failed to load config: %v", err)
 	}
 
-	openAIClient := openai.NewClient(cfg.OpenAIKey)
-	store := memory.NewStore()
-	chatSvc := chat.NewService(store, openAIClient, cfg)
-	ttsSvc := tts.NewService(openAIClient, cfg)
-	imgSvc := image.NewService(openAIClient, cfg)
+	ctx, cancel := signal.NotifyContext(context.Background(),
+		syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
 
-	bot, err := telegram.NewBot(cfg, chatSvc, ttsSvc, imgSvc)
+	stores, closeStore, err := newStores(ctx, cfg)
 	if err != nil {
-		log.Fatalf("failed to init telegram bot: %v", err)
+		log.Fatalf("failed to init store: %v", err)
 	}
+	defer closeStore()
 
-	ctx, cancel := signal.NotifyContext(context.Background(),
-		syscall.SIGINT, syscall.SIGTERM)
-	defer cancel()
+	openAIClient := openai.NewClient(cfg)
+	retryPolicy := retry.PolicyFromConfig(cfg)
+	chatClient := router.New(cfg)
+	if cfg.AnthropicKey != "" {
+		chatClient.Add("anthropic", retry.NewChatClient(anthropic.NewClient(cfg), retryPolicy), "claude")
+	}
+	chatClient.Add("openai", retry.NewChatClient(openAIClient, retryPolicy))
+	var toolRegistry *chat.ToolRegistry
+	if cfg.ToolsEnabled {
+		toolRegistry, err = tools.NewBuiltinRegistry()
+		if err != nil {
+			log.Fatalf("failed to register tools: %v", err)
+		}
+	}
+
+	chatSvc := chat.NewService(stores.conversations, stores.settings, chatClient, tokenizer.NewTiktoken(), toolRegistry, cfg)
+	ttsSvc := tts.NewService(retry.NewSpeechClient(openAIClient, retryPolicy), cfg)
+	imgSvc := image.NewService(retry.NewImageClient(openAIClient, retryPolicy), cfg)
+	sttSvc := transcribe.NewService(openAIClient, cfg)
+	usageSvc := usage.NewService(stores.usage, cfg)
+	quotaSvc := quota.NewService(cfg)
+
+	bot, err := telegram.NewBot(cfg, chatSvc, ttsSvc, imgSvc, sttSvc, usageSvc, quotaSvc)
+	if err != nil {
+		log.Fatalf("failed to init telegram bot: %v", err)
+	}
 
 	if err := bot.Run(ctx); err != nil {
 		if ctx.Err() != nil {
@@ -44,3 +76,40 @@ func main() {
 		log.Fatalf("bot stopped with error: %v", err)
 	}
 }
+
+type stores struct {
+	conversations domain.ConversationStore
+	settings      domain.SettingsStore
+	usage         domain.UsageLedger
+}
+
+func newStores(ctx context.Context, cfg config.Config) (stores, func(), error) {
+	switch cfg.StoreDriver {
+	case "sqlite":
+		store, err := sqlite.NewStore(cfg.StoreDSN)
+		if err != nil {
+			return stores{}, nil, err
+		}
+		return stores{
+			conversations: store,
+			settings:      store,
+			usage:         store,
+		}, func() {
+			if err := store.Close(); err != nil {
+				log.Printf("failed to close store: %v", err)
+			}
+		}, nil
+	default:
+		store := memory.NewStore(memory.Options{
+			TTL:                cfg.ContextTTL,
+			MaxMessagesPerChat: cfg.ContextChatCap,
+			MaxMessages:        cfg.StoreMaxMessages,
+		})
+		go store.RunJanitor(ctx, cfg.JanitorInterval)
+		return stores{
+			conversations: store,
+			settings:      memory.NewSettingsStore(),
+			usage:         memory.NewUsageLedger(),
+		}, func() {}, nil
+	}
+}
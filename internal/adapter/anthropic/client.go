@@ -0,0 +1,93 @@
+package anthropic
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"chatgpt-telegram-bot/internal/config"
+	"chatgpt-telegram-bot/internal/usecase/chat"
+)
+
+// Client talks to the Anthropic Messages API.
+type Client struct {
+	http *http.Client
+	cfg  config.Config
+}
+
+func NewClient(cfg config.Config) *Client {
+	return &Client{
+		http: &http.Client{Timeout: cfg.AnthropicTimeout},
+		cfg:  cfg,
+	}
+}
+
+func (c *Client) Complete(ctx context.Context, req chat.CompletionRequest) (chat.Completion, error) {
+	resp, err := c.post(ctx, toAPIRequest(req, false))
+	if err != nil {
+		return chat.Completion{}, err
+	}
+	defer resp.Body.Close()
+
+	var apiResp messagesResponse
+	if err := json.NewDecoder(resp.Body).Decode(&apiResp); err != nil {
+		return chat.Completion{}, fmt.Errorf("decode anthropic response: %w", err)
+	}
+
+	completion := fromAPIResponse(apiResp)
+	if completion.Text == "" && len(completion.ToolCalls) == 0 {
+		return chat.Completion{}, errors.New("anthropic returned empty response")
+	}
+	return completion, nil
+}
+
+func (c *Client) CompleteStream(ctx context.Context, req chat.CompletionRequest, onDelta func(delta string) error) (chat.Completion, error) {
+	resp, err := c.post(ctx, toAPIRequest(req, true))
+	if err != nil {
+		return chat.Completion{}, err
+	}
+	defer resp.Body.Close()
+
+	completion, err := readStream(resp.Body, onDelta)
+	if err != nil {
+		return chat.Completion{}, err
+	}
+	if completion.Text == "" && len(completion.ToolCalls) == 0 {
+		return chat.Completion{}, errors.New("anthropic returned empty response")
+	}
+	return completion, nil
+}
+
+// post sends a Messages API request and returns the response of a
+// successful call; failures come back as classified errors.
+func (c *Client) post(ctx context.Context, apiReq messagesRequest) (*http.Response, error) {
+	body, err := json.Marshal(apiReq)
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.cfg.AnthropicBaseURL+"/v1/messages", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("x-api-key", c.cfg.AnthropicKey)
+	httpReq.Header.Set("anthropic-version", c.cfg.AnthropicVersion)
+
+	resp, err := c.http.Do(httpReq)
+	if err != nil {
+		return nil, classify(err)
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(resp.Body)
+	return nil, classifyResponse(resp.StatusCode, respBody, parseRetryAfter(resp.Header, time.Now()))
+}
@@ -0,0 +1,288 @@
+package anthropic
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"chatgpt-telegram-bot/internal/config"
+	"chatgpt-telegram-bot/internal/domain"
+	"chatgpt-telegram-bot/internal/usecase/chat"
+)
+
+func newTestClient(t *testing.T, handler http.HandlerFunc) *Client {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	return NewClient(config.Config{
+		AnthropicKey:     "test-key",
+		AnthropicBaseURL: srv.URL,
+		AnthropicVersion: "2023-06-01",
+		AnthropicTimeout: 5 * time.Second,
+	})
+}
+
+func TestCompleteSendsMessagesRequest(t *testing.T) {
+	var got messagesRequest
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/v1/messages" {
+			t.Errorf("request %s %s, want POST /v1/messages", r.Method, r.URL.Path)
+		}
+		if key := r.Header.Get("x-api-key"); key != "test-key" {
+			t.Errorf("x-api-key = %q, want test-key", key)
+		}
+		if v := r.Header.Get("anthropic-version"); v != "2023-06-01" {
+			t.Errorf("anthropic-version = %q, want 2023-06-01", v)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("decode request: %v", err)
+		}
+		io.WriteString(w, `{
+			"content": [
+				{"type": "text", "text": "Let me check."},
+				{"type": "tool_use", "id": "call_1", "name": "time", "input": {"zone": "UTC"}}
+			],
+			"stop_reason": "tool_use",
+			"usage": {"input_tokens": 12, "output_tokens": 7}
+		}`)
+	})
+
+	temp := float32(0)
+	resp, err := client.Complete(context.Background(), chat.CompletionRequest{
+		Model: "claude-sonnet-4-5",
+		Messages: []chat.Message{
+			{Role: domain.RoleSystem, Text: "be brief"},
+			{Role: domain.RoleAssistant, Text: "dropped: the conversation opens with a user turn"},
+			{Role: domain.RoleUser, Text: "what is this?", Images: []string{"data:image/png;base64,AAAA"}},
+			{Role: domain.RoleAssistant, ToolCalls: []chat.ToolCall{{ID: "call_0", Name: "time", Arguments: `{}`}}},
+			{Role: domain.RoleTool, ToolCallID: "call_0", Text: "12:00"},
+		},
+		Temperature: &temp,
+		Tools:       []chat.ToolDefinition{{Name: "time", Parameters: json.RawMessage(`{"type":"object"}`)}},
+		ToolChoice:  chat.ToolChoiceNone,
+	})
+	if err != nil {
+		t.Fatalf("Complete() error: %v", err)
+	}
+
+	if got.Model != "claude-sonnet-4-5" || got.System != "be brief" || got.MaxTokens != defaultMaxTokens {
+		t.Errorf("request model %q, system %q, max tokens %d", got.Model, got.System, got.MaxTokens)
+	}
+	if got.Temperature == nil || *got.Temperature != 0 {
+		t.Errorf("request temperature = %v, want 0", got.Temperature)
+	}
+	if got.ToolChoice == nil || got.ToolChoice.Type != "none" || len(got.Tools) != 1 {
+		t.Errorf("request tools %+v, tool choice %+v", got.Tools, got.ToolChoice)
+	}
+	if len(got.Messages) != 3 {
+		t.Fatalf("request has %d messages, want 3: %+v", len(got.Messages), got.Messages)
+	}
+	user := got.Messages[0]
+	if user.Role != "user" || len(user.Content) != 2 || user.Content[0].Type != "image" ||
+		user.Content[0].Source.MediaType != "image/png" || user.Content[0].Source.Data != "AAAA" {
+		t.Errorf("user turn = %+v, want an image and a text block", user)
+	}
+	if call := got.Messages[1].Content[0]; call.Type != "tool_use" || call.ID != "call_0" {
+		t.Errorf("assistant turn = %+v, want a tool_use block", got.Messages[1])
+	}
+	if result := got.Messages[2]; result.Role != "user" || result.Content[0].Type != "tool_result" ||
+		result.Content[0].ToolUseID != "call_0" || result.Content[0].Content != "12:00" {
+		t.Errorf("tool result turn = %+v", result)
+	}
+
+	if resp.Text != "Let me check." || resp.Truncated {
+		t.Errorf("Complete() text %q, truncated %t", resp.Text, resp.Truncated)
+	}
+	if len(resp.ToolCalls) != 1 || resp.ToolCalls[0].Name != "time" || resp.ToolCalls[0].Arguments != `{"zone": "UTC"}` {
+		t.Errorf("Complete() tool calls = %+v", resp.ToolCalls)
+	}
+	if resp.Usage.PromptTokens != 12 || resp.Usage.CompletionTokens != 7 {
+		t.Errorf("Complete() usage = %+v", resp.Usage)
+	}
+}
+
+const streamBody = `event: message_start
+data: {"type":"message_start","message":{"usage":{"input_tokens":20,"output_tokens":1}}}
+
+event: content_block_start
+data: {"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}
+
+event: ping
+data: {"type":"ping"}
+
+event: content_block_delta
+data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hello"}}
+
+event: content_block_delta
+data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":", world"}}
+
+event: content_block_start
+data: {"type":"content_block_start","index":1,"content_block":{"type":"tool_use","id":"call_1","name":"calculator","input":{}}}
+
+event: content_block_delta
+data: {"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"{\"expr\":"}}
+
+event: content_block_delta
+data: {"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"\"2+2\"}"}}
+
+event: message_delta
+data: {"type":"message_delta","delta":{"stop_reason":"max_tokens"},"usage":{"output_tokens":15}}
+
+event: message_stop
+data: {"type":"message_stop"}
+
+`
+
+func TestCompleteStreamReadsEvents(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		var req messagesRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || !req.Stream {
+			t.Errorf("stream request = %+v (%v), want stream set", req, err)
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, streamBody)
+	})
+
+	var deltas []string
+	resp, err := client.CompleteStream(context.Background(), chat.CompletionRequest{
+		Model:    "claude-sonnet-4-5",
+		Messages: []chat.Message{{Role: domain.RoleUser, Text: "hi"}},
+	}, func(delta string) error {
+		deltas = append(deltas, delta)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("CompleteStream() error: %v", err)
+	}
+
+	if strings.Join(deltas, "|") != "Hello|, world" || resp.Text != "Hello, world" {
+		t.Errorf("deltas %q, text %q", deltas, resp.Text)
+	}
+	if len(resp.ToolCalls) != 1 || resp.ToolCalls[0].ID != "call_1" || resp.ToolCalls[0].Arguments != `{"expr":"2+2"}` {
+		t.Errorf("tool calls = %+v", resp.ToolCalls)
+	}
+	if !resp.Truncated || resp.Usage.PromptTokens != 20 || resp.Usage.CompletionTokens != 15 {
+		t.Errorf("truncated %t, usage %+v", resp.Truncated, resp.Usage)
+	}
+}
+
+func TestCompleteStreamErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		body      string
+		kind      error
+		retryable bool
+	}{
+		{
+			name:      "overloaded event",
+			body:      "event: error\ndata: {\"type\":\"error\",\"error\":{\"type\":\"overloaded_error\",\"message\":\"Overloaded\"}}\n\n",
+			kind:      domain.ErrUnavailable,
+			retryable: true,
+		},
+		{
+			name:      "cut off before message_stop",
+			body:      "event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"text_delta\",\"text\":\"Hel\"}}\n\n",
+			kind:      domain.ErrUnavailable,
+			retryable: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				io.WriteString(w, tt.body)
+			})
+			_, err := client.CompleteStream(context.Background(), chat.CompletionRequest{
+				Messages: []chat.Message{{Role: domain.RoleUser, Text: "hi"}},
+			}, func(string) error { return nil })
+
+			var perr *domain.ProviderError
+			if !errors.As(err, &perr) || !errors.Is(err, tt.kind) || perr.Retryable != tt.retryable {
+				t.Fatalf("CompleteStream() error = %v, want %v with retryable %t", err, tt.kind, tt.retryable)
+			}
+		})
+	}
+}
+
+func TestCompleteMapsErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		retryAfter string
+		body       string
+		kind       error
+		retryable  bool
+		wait       time.Duration
+	}{
+		{
+			name:       "rate limited",
+			status:     http.StatusTooManyRequests,
+			retryAfter: "7",
+			body:       `{"type":"error","error":{"type":"rate_limit_error","message":"Number of requests has exceeded your rate limit"}}`,
+			kind:       domain.ErrRateLimited,
+			retryable:  true,
+			wait:       7 * time.Second,
+		},
+		{
+			name:      "overloaded",
+			status:    statusOverloaded,
+			body:      `{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`,
+			kind:      domain.ErrUnavailable,
+			retryable: true,
+		},
+		{
+			name:   "bad key",
+			status: http.StatusUnauthorized,
+			body:   `{"type":"error","error":{"type":"authentication_error","message":"invalid x-api-key"}}`,
+			kind:   domain.ErrUnauthorized,
+		},
+		{
+			name:   "prompt too long",
+			status: http.StatusBadRequest,
+			body:   `{"type":"error","error":{"type":"invalid_request_error","message":"prompt is too long: 210000 tokens > 200000 maximum"}}`,
+			kind:   chat.ErrContextTooLong,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				if tt.retryAfter != "" {
+					w.Header().Set("Retry-After", tt.retryAfter)
+				}
+				w.WriteHeader(tt.status)
+				io.WriteString(w, tt.body)
+			})
+			_, err := client.Complete(context.Background(), chat.CompletionRequest{
+				Messages: []chat.Message{{Role: domain.RoleUser, Text: "hi"}},
+			})
+
+			var perr *domain.ProviderError
+			if !errors.As(err, &perr) || !errors.Is(err, tt.kind) {
+				t.Fatalf("Complete() error = %v, want %v", err, tt.kind)
+			}
+			if perr.Retryable != tt.retryable || perr.RetryAfter != tt.wait {
+				t.Errorf("retryable %t after %s, want %t after %s", perr.Retryable, perr.RetryAfter, tt.retryable, tt.wait)
+			}
+		})
+	}
+}
+
+func TestCompleteUnclassifiedError(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"type":"error","error":{"type":"invalid_request_error","message":"max_tokens: must be positive"}}`)
+	})
+	_, err := client.Complete(context.Background(), chat.CompletionRequest{
+		Messages: []chat.Message{{Role: domain.RoleUser, Text: "hi"}},
+	})
+
+	var perr *domain.ProviderError
+	if err == nil || errors.As(err, &perr) || !strings.Contains(err.Error(), "must be positive") {
+		t.Fatalf("Complete() error = %v, want a plain error with the API message", err)
+	}
+}
@@ -0,0 +1,87 @@
+package anthropic
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"chatgpt-telegram-bot/internal/domain"
+	"chatgpt-telegram-bot/internal/usecase/chat"
+)
+
+// statusOverloaded is Anthropic's status for a temporarily overloaded API.
+const statusOverloaded = 529
+
+type errorResponse struct {
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// classifyResponse turns a failed HTTP response into a domain.ProviderError.
+func classifyResponse(status int, body []byte, retryAfter time.Duration) error {
+	var apiErr errorResponse
+	_ = json.Unmarshal(body, &apiErr)
+	msg := apiErr.Error.Message
+	if msg == "" {
+		msg = strings.TrimSpace(string(body))
+	}
+	err := fmt.Errorf("anthropic error: status %d: %s", status, msg)
+
+	perr := &domain.ProviderError{Err: err, RetryAfter: retryAfter}
+	switch {
+	case status == http.StatusBadRequest && strings.Contains(strings.ToLower(msg), "prompt is too long"):
+		perr.Kind = chat.ErrContextTooLong
+	case status == http.StatusUnauthorized, status == http.StatusForbidden:
+		perr.Kind = domain.ErrUnauthorized
+	case status == http.StatusTooManyRequests:
+		perr.Kind, perr.Retryable = domain.ErrRateLimited, true
+	case status == http.StatusRequestTimeout, status == http.StatusGatewayTimeout:
+		perr.Kind, perr.Retryable = domain.ErrTimeout, true
+	case status == statusOverloaded, status >= 500:
+		perr.Kind, perr.Retryable = domain.ErrUnavailable, true
+	default:
+		return err
+	}
+	return perr
+}
+
+// classify wraps transport failures in a domain.ProviderError.
+func classify(err error) error {
+	if errors.Is(err, context.Canceled) {
+		return err
+	}
+	var (
+		netErr net.Error
+		urlErr *url.Error
+	)
+	switch {
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return &domain.ProviderError{Kind: domain.ErrTimeout, Retryable: true, Err: err}
+	case errors.As(err, &urlErr):
+		return &domain.ProviderError{Kind: domain.ErrUnavailable, Retryable: true, Err: err}
+	}
+	return err
+}
+
+func parseRetryAfter(h http.Header, now time.Time) time.Duration {
+	value := strings.TrimSpace(h.Get("Retry-After"))
+	if value == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(value); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil && at.After(now) {
+		return at.Sub(now)
+	}
+	return 0
+}
@@ -0,0 +1,225 @@
+package anthropic
+
+import (
+	"encoding/json"
+	"strings"
+
+	"chatgpt-telegram-bot/internal/domain"
+	"chatgpt-telegram-bot/internal/usecase/chat"
+)
+
+type messagesRequest struct {
+	Model       string         `json:"model"`
+	MaxTokens   int            `json:"max_tokens"`
+	System      string         `json:"system,omitempty"`
+	Messages    []apiMessage   `json:"messages"`
+	Temperature *float32       `json:"temperature,omitempty"`
+	Tools       []apiTool      `json:"tools,omitempty"`
+	ToolChoice  *apiToolChoice `json:"tool_choice,omitempty"`
+	Stream      bool           `json:"stream,omitempty"`
+}
+
+type apiMessage struct {
+	Role    string         `json:"role"`
+	Content []contentBlock `json:"content"`
+}
+
+// contentBlock is any block of a message; only the fields of its type are set.
+type contentBlock struct {
+	Type      string          `json:"type"`
+	Text      string          `json:"text,omitempty"`
+	Source    *imageSource    `json:"source,omitempty"`
+	ID        string          `json:"id,omitempty"`
+	Name      string          `json:"name,omitempty"`
+	Input     json.RawMessage `json:"input,omitempty"`
+	ToolUseID string          `json:"tool_use_id,omitempty"`
+	Content   string          `json:"content,omitempty"`
+}
+
+type imageSource struct {
+	Type      string `json:"type"`
+	MediaType string `json:"media_type,omitempty"`
+	Data      string `json:"data,omitempty"`
+	URL       string `json:"url,omitempty"`
+}
+
+type apiTool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	InputSchema json.RawMessage `json:"input_schema"`
+}
+
+type apiToolChoice struct {
+	Type string `json:"type"`
+}
+
+type messagesResponse struct {
+	Content    []contentBlock `json:"content"`
+	StopReason string         `json:"stop_reason"`
+	Usage      apiUsage       `json:"usage"`
+}
+
+type apiUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+// stopMaxTokens is the stop reason of a reply cut off by max_tokens.
+const stopMaxTokens = "max_tokens"
+
+// defaultMaxTokens is used when the request sets no limit; the API requires one.
+const defaultMaxTokens = 4096
+
+func toAPIRequest(req chat.CompletionRequest, stream bool) messagesRequest {
+	system, msgs := toAPIMessages(req.Messages)
+	apiReq := messagesRequest{
+		Model:     req.Model,
+		MaxTokens: req.MaxCompletionTokens,
+		System:    system,
+		Messages:  msgs,
+		Tools:     toAPITools(req.Tools),
+		Stream:    stream,
+	}
+	if apiReq.MaxTokens <= 0 {
+		apiReq.MaxTokens = defaultMaxTokens
+	}
+	if req.Temperature != nil {
+		// Anthropic accepts 0..1 where OpenAI accepts 0..2
+		temp := min(*req.Temperature, 1)
+		apiReq.Temperature = &temp
+	}
+	if req.ToolChoice == chat.ToolChoiceNone && len(apiReq.Tools) > 0 {
+		apiReq.ToolChoice = &apiToolChoice{Type: "none"}
+	}
+	return apiReq
+}
+
+// toAPIMessages lifts system messages into the top-level system prompt and
+// converts the rest into alternating user and assistant turns. Tool results
+// are user turns in the Messages API, so consecutive results are merged.
+func toAPIMessages(msgs []chat.Message) (string, []apiMessage) {
+	var (
+		system []string
+		res    []apiMessage
+	)
+	for _, m := range msgs {
+		var (
+			role   string
+			blocks []contentBlock
+		)
+		switch m.Role {
+		case domain.RoleSystem:
+			if text := strings.TrimSpace(m.Text); text != "" {
+				system = append(system, text)
+			}
+			continue
+		case domain.RoleTool:
+			role = domain.RoleUser
+			blocks = []contentBlock{{Type: "tool_result", ToolUseID: m.ToolCallID, Content: m.Text}}
+		case domain.RoleAssistant:
+			role = domain.RoleAssistant
+			if strings.TrimSpace(m.Text) != "" {
+				blocks = append(blocks, contentBlock{Type: "text", Text: m.Text})
+			}
+			for _, call := range m.ToolCalls {
+				blocks = append(blocks, contentBlock{
+					Type:  "tool_use",
+					ID:    call.ID,
+					Name:  call.Name,
+					Input: toolInput(call.Arguments),
+				})
+			}
+		default:
+			role = domain.RoleUser
+			for _, img := range m.Images {
+				blocks = append(blocks, contentBlock{Type: "image", Source: toImageSource(img)})
+			}
+			if strings.TrimSpace(m.Text) != "" {
+				blocks = append(blocks, contentBlock{Type: "text", Text: m.Text})
+			}
+		}
+		if len(blocks) == 0 {
+			continue
+		}
+
+		if n := len(res); n > 0 && res[n-1].Role == role {
+			res[n-1].Content = append(res[n-1].Content, blocks...)
+			continue
+		}
+		if len(res) == 0 && role != domain.RoleUser {
+			// the conversation must open with a user turn
+			continue
+		}
+		res = append(res, apiMessage{Role: role, Content: blocks})
+	}
+	return strings.Join(system, "\n\n"), res
+}
+
+// toImageSource turns a data URL into a base64 source; anything else is
+// passed on as a URL for the API to fetch.
+func toImageSource(img string) *imageSource {
+	rest, ok := strings.CutPrefix(img, "data:")
+	if !ok {
+		return &imageSource{Type: "url", URL: img}
+	}
+	meta, data, ok := strings.Cut(rest, ",")
+	mediaType, isBase64 := strings.CutSuffix(meta, ";base64")
+	if !ok || !isBase64 {
+		return &imageSource{Type: "url", URL: img}
+	}
+	return &imageSource{Type: "base64", MediaType: mediaType, Data: data}
+}
+
+func toolInput(args string) json.RawMessage {
+	if strings.TrimSpace(args) == "" || !json.Valid([]byte(args)) {
+		return json.RawMessage("{}")
+	}
+	return json.RawMessage(args)
+}
+
+func toAPITools(defs []chat.ToolDefinition) []apiTool {
+	if len(defs) == 0 {
+		return nil
+	}
+	tools := make([]apiTool, 0, len(defs))
+	for _, d := range defs {
+		tools = append(tools, apiTool{
+			Name:        d.Name,
+			Description: d.Description,
+			InputSchema: d.Parameters,
+		})
+	}
+	return tools
+}
+
+func fromAPIResponse(resp messagesResponse) chat.Completion {
+	var (
+		sb    strings.Builder
+		calls []chat.ToolCall
+	)
+	for _, block := range resp.Content {
+		switch block.Type {
+		case "text":
+			sb.WriteString(block.Text)
+		case "tool_use":
+			calls = append(calls, chat.ToolCall{
+				ID:        block.ID,
+				Name:      block.Name,
+				Arguments: string(block.Input),
+			})
+		}
+	}
+	return chat.Completion{
+		Text:      sb.String(),
+		ToolCalls: calls,
+		Usage:     fromAPIUsage(resp.Usage),
+		Truncated: resp.StopReason == stopMaxTokens,
+	}
+}
+
+func fromAPIUsage(u apiUsage) chat.Usage {
+	return chat.Usage{
+		PromptTokens:     u.InputTokens,
+		CompletionTokens: u.OutputTokens,
+	}
+}
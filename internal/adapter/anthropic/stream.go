@@ -0,0 +1,138 @@
+package anthropic
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"chatgpt-telegram-bot/internal/domain"
+	"chatgpt-telegram-bot/internal/usecase/chat"
+)
+
+// streamEvent is a server-sent event of a streamed Messages API response;
+// only the fields of its type are set.
+type streamEvent struct {
+	Type    string `json:"type"`
+	Index   int    `json:"index"`
+	Message struct {
+		Usage apiUsage `json:"usage"`
+	} `json:"message"`
+	ContentBlock contentBlock `json:"content_block"`
+	Delta        struct {
+		Type        string `json:"type"`
+		Text        string `json:"text"`
+		PartialJSON string `json:"partial_json"`
+		StopReason  string `json:"stop_reason"`
+	} `json:"delta"`
+	Usage apiUsage `json:"usage"`
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// readStream reads server-sent events until the message ends, passing text
+// deltas to onDelta and joining tool input fragments by block index.
+func readStream(r io.Reader, onDelta func(delta string) error) (chat.Completion, error) {
+	var (
+		sb        strings.Builder
+		usage     chat.Usage
+		truncated bool
+		calls     = make(map[int]*chat.ToolCall)
+		args      = make(map[int]*strings.Builder)
+	)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			continue
+		}
+		var ev streamEvent
+		if err := json.Unmarshal([]byte(strings.TrimSpace(data)), &ev); err != nil {
+			return chat.Completion{}, fmt.Errorf("decode anthropic stream: %w", err)
+		}
+
+		switch ev.Type {
+		case "message_start":
+			usage.PromptTokens = ev.Message.Usage.InputTokens
+		case "content_block_start":
+			if ev.ContentBlock.Type == "tool_use" {
+				calls[ev.Index] = &chat.ToolCall{ID: ev.ContentBlock.ID, Name: ev.ContentBlock.Name}
+				args[ev.Index] = &strings.Builder{}
+			}
+		case "content_block_delta":
+			switch ev.Delta.Type {
+			case "text_delta":
+				if ev.Delta.Text == "" {
+					continue
+				}
+				sb.WriteString(ev.Delta.Text)
+				if err := onDelta(ev.Delta.Text); err != nil {
+					return chat.Completion{}, err
+				}
+			case "input_json_delta":
+				if b, ok := args[ev.Index]; ok {
+					b.WriteString(ev.Delta.PartialJSON)
+				}
+			}
+		case "message_delta":
+			usage.CompletionTokens = ev.Usage.OutputTokens
+			truncated = ev.Delta.StopReason == stopMaxTokens
+		case "message_stop":
+			return chat.Completion{
+				Text:      sb.String(),
+				ToolCalls: joinToolCalls(calls, args),
+				Usage:     usage,
+				Truncated: truncated,
+			}, nil
+		case "error":
+			return chat.Completion{}, streamError(ev.Error.Type, ev.Error.Message)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return chat.Completion{}, classify(err)
+	}
+	return chat.Completion{}, &domain.ProviderError{
+		Kind:      domain.ErrUnavailable,
+		Retryable: true,
+		Err:       io.ErrUnexpectedEOF,
+	}
+}
+
+func streamError(typ, msg string) error {
+	err := fmt.Errorf("anthropic stream error: %s: %s", typ, msg)
+	switch typ {
+	case "overloaded_error", "api_error":
+		return &domain.ProviderError{Kind: domain.ErrUnavailable, Retryable: true, Err: err}
+	case "rate_limit_error":
+		return &domain.ProviderError{Kind: domain.ErrRateLimited, Retryable: true, Err: err}
+	}
+	return err
+}
+
+func joinToolCalls(calls map[int]*chat.ToolCall, args map[int]*strings.Builder) []chat.ToolCall {
+	if len(calls) == 0 {
+		return nil
+	}
+	indexes := make([]int, 0, len(calls))
+	for idx := range calls {
+		indexes = append(indexes, idx)
+	}
+	sort.Ints(indexes)
+
+	res := make([]chat.ToolCall, 0, len(indexes))
+	for _, idx := range indexes {
+		call := *calls[idx]
+		call.Arguments = args[idx].String()
+		if call.Arguments == "" {
+			call.Arguments = "{}"
+		}
+		res = append(res, call)
+	}
+	return res
+}
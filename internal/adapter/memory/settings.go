@@ -0,0 +1,30 @@
+package memory
+
+import (
+	"sync"
+
+	"chatgpt-telegram-bot/internal/domain"
+)
+
+type SettingsStore struct {
+	mu       sync.Mutex
+	settings map[int64]domain.ChatSettings
+}
+
+func NewSettingsStore() *SettingsStore {
+	return &SettingsStore{
+		settings: make(map[int64]domain.ChatSettings),
+	}
+}
+
+func (s *SettingsStore) Settings(chatID int64) domain.ChatSettings {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.settings[chatID]
+}
+
+func (s *SettingsStore) SaveSettings(chatID int64, settings domain.ChatSettings) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.settings[chatID] = settings
+}
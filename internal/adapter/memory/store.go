@@ -1,41 +1,96 @@
 package memory
 
 import (
+	"container/list"
+	"context"
+	"log"
+	"slices"
 	"sync"
 	"time"
 
 	"chatgpt-telegram-bot/internal/domain"
 )
 
+type Options struct {
+	TTL                time.Duration
+	MaxMessagesPerChat int
+	MaxMessages        int
+	Now                func() time.Time
+}
+
+type Stats struct {
+	Chats             int
+	Messages          int
+	ExpiredEvictions  uint64
+	ChatCapEvictions  uint64
+	IdleChatEvictions uint64
+}
+
+type conversation struct {
+	chatID   int64
+	messages []domain.Message
+	summary  domain.Summary
+	elem     *list.Element
+}
+
 type Store struct {
 	mu            sync.Mutex
-	conversations map[int64][]domain.Message
+	opts          Options
+	conversations map[int64]*conversation
+	lru           *list.List
+	total         int
+	stats         Stats
 }
 
-func NewStore() *Store {
+func NewStore(opts Options) *Store {
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
 	return &Store{
-		conversations: make(map[int64][]domain.Message),
+		opts:          opts,
+		conversations: make(map[int64]*conversation),
+		lru:           list.New(),
 	}
 }
 
 func (s *Store) Add(chatID int64, msg domain.Message) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	s.conversations[chatID] = append(s.conversations[chatID], msg)
+
+	conv := s.touch(chatID)
+	conv.messages = append(conv.messages, msg)
+	s.total++
+
+	if limit := s.opts.MaxMessagesPerChat; limit > 0 && len(conv.messages) > limit {
+		dropped := len(conv.messages) - limit
+		conv.messages = append([]domain.Message(nil), conv.messages[dropped:]...)
+		s.total -= dropped
+		s.stats.ChatCapEvictions += uint64(dropped)
+	}
+
+	for s.opts.MaxMessages > 0 && s.total > s.opts.MaxMessages {
+		oldest := s.lru.Back()
+		if oldest == nil || oldest.Value.(*conversation) == conv {
+			break
+		}
+		s.remove(oldest.Value.(*conversation))
+		s.stats.IdleChatEvictions++
+	}
 }
 
 func (s *Store) FreshMessages(chatID int64, limit int, ttl time.Duration) []domain.Message {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	history := s.conversations[chatID]
-	if len(history) == 0 {
+	conv, ok := s.conversations[chatID]
+	if !ok || len(conv.messages) == 0 {
 		return nil
 	}
+	s.touch(chatID)
 
-	cutoff := time.Now().Add(-ttl)
-	fresh := make([]domain.Message, 0, len(history))
-	for _, m := range history {
+	cutoff := s.opts.Now().Add(-ttl)
+	fresh := make([]domain.Message, 0, len(conv.messages))
+	for _, m := range conv.messages {
 		if m.Timestamp.After(cutoff) {
 			fresh = append(fresh, m)
 		}
@@ -47,3 +102,193 @@ func (s *Store) FreshMessages(chatID int64, limit int, ttl time.Duration) []doma
 
 	return append([]domain.Message(nil), fresh...)
 }
+
+func (s *Store) List(chatID int64, limit int) []domain.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	conv, ok := s.conversations[chatID]
+	if !ok || limit <= 0 {
+		return nil
+	}
+
+	history := conv.messages
+	if len(history) > limit {
+		history = history[len(history)-limit:]
+	}
+	return append([]domain.Message(nil), history...)
+}
+
+func (s *Store) Thread(chatID int64, messageID int, limit int, ttl time.Duration) []domain.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	conv, ok := s.conversations[chatID]
+	if !ok || messageID == 0 || limit <= 0 {
+		return nil
+	}
+	s.touch(chatID)
+
+	byID := make(map[int]domain.Message, len(conv.messages))
+	for _, m := range conv.messages {
+		if m.MessageID != 0 {
+			byID[m.MessageID] = m
+		}
+	}
+
+	cutoff := s.opts.Now().Add(-ttl)
+	var thread []domain.Message
+	for id := messageID; id != 0 && len(thread) < limit; {
+		m, ok := byID[id]
+		if !ok || !m.Timestamp.After(cutoff) {
+			break
+		}
+		delete(byID, id) // guards against parent cycles
+		thread = append(thread, m)
+		id = m.ParentID
+	}
+	slices.Reverse(thread)
+	return thread
+}
+
+func (s *Store) SetReplyID(chatID int64, parentID, messageID int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	conv, ok := s.conversations[chatID]
+	if !ok {
+		return
+	}
+	for i := len(conv.messages) - 1; i >= 0; i-- {
+		m := &conv.messages[i]
+		if m.Role == domain.RoleAssistant && m.ParentID == parentID && m.MessageID == 0 {
+			m.MessageID = messageID
+			return
+		}
+	}
+}
+
+func (s *Store) DeleteLast(chatID int64, n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	conv, ok := s.conversations[chatID]
+	if !ok || n <= 0 {
+		return
+	}
+	n = min(n, len(conv.messages))
+	conv.messages = conv.messages[:len(conv.messages)-n]
+	s.total -= n
+}
+
+func (s *Store) Clear(chatID int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if conv, ok := s.conversations[chatID]; ok {
+		s.remove(conv)
+	}
+}
+
+func (s *Store) Summary(chatID int64) domain.Summary {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if conv, ok := s.conversations[chatID]; ok {
+		return conv.summary
+	}
+	return domain.Summary{}
+}
+
+func (s *Store) SaveSummary(chatID int64, summary domain.Summary) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.touch(chatID).summary = summary
+}
+
+// RunJanitor drops expired messages every interval until ctx is done.
+func (s *Store) RunJanitor(ctx context.Context, interval time.Duration) {
+	if interval <= 0 || s.opts.TTL <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if n := s.Sweep(); n > 0 {
+				st := s.Stats()
+				log.Printf("memory store: evicted %d expired messages (chats %d, messages %d)",
+					n, st.Chats, st.Messages)
+			}
+		}
+	}
+}
+
+// Sweep removes messages and summaries older than the configured TTL and
+// returns how many messages were dropped.
+func (s *Store) Sweep() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.opts.TTL <= 0 {
+		return 0
+	}
+
+	cutoff := s.opts.Now().Add(-s.opts.TTL)
+	dropped := 0
+	for _, conv := range s.conversations {
+		kept := conv.messages[:0]
+		for _, m := range conv.messages {
+			if m.Timestamp.After(cutoff) {
+				kept = append(kept, m)
+			}
+		}
+		if n := len(conv.messages) - len(kept); n > 0 {
+			clear(conv.messages[len(kept):])
+			conv.messages = kept
+			s.total -= n
+			dropped += n
+		}
+		// a summary lives for the TTL after its last update
+		if len(conv.messages) == 0 && !conv.summary.UpdatedAt.After(cutoff) {
+			s.remove(conv)
+		}
+	}
+	s.stats.ExpiredEvictions += uint64(dropped)
+
+	return dropped
+}
+
+func (s *Store) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st := s.stats
+	st.Chats = len(s.conversations)
+	st.Messages = s.total
+	return st
+}
+
+func (s *Store) touch(chatID int64) *conversation {
+	conv, ok := s.conversations[chatID]
+	if !ok {
+		conv = &conversation{chatID: chatID}
+		conv.elem = s.lru.PushFront(conv)
+		s.conversations[chatID] = conv
+	} else {
+		s.lru.MoveToFront(conv.elem)
+	}
+	return conv
+}
+
+func (s *Store) remove(conv *conversation) {
+	s.lru.Remove(conv.elem)
+	delete(s.conversations, conv.chatID)
+	s.total -= len(conv.messages)
+}
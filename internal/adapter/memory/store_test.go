@@ -0,0 +1,210 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"chatgpt-telegram-bot/internal/domain"
+)
+
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func newTestStore(opts Options) (*Store, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)}
+	opts.Now = clock.Now
+	return NewStore(opts), clock
+}
+
+func addMessage(s *Store, clock *fakeClock, chatID int64, content string) {
+	s.Add(chatID, domain.Message{Role: domain.RoleUser, Content: content, Timestamp: clock.Now()})
+}
+
+func chatMessages(s *Store, chatID int64) []domain.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	conv, ok := s.conversations[chatID]
+	if !ok {
+		return nil
+	}
+	return append([]domain.Message(nil), conv.messages...)
+}
+
+func TestSweepDropsExpiredMessages(t *testing.T) {
+	s, clock := newTestStore(Options{TTL: time.Hour})
+
+	addMessage(s, clock, 1, "old")
+	addMessage(s, clock, 2, "old")
+	clock.Advance(40 * time.Minute)
+	addMessage(s, clock, 1, "new")
+
+	if n := s.Sweep(); n != 0 {
+		t.Fatalf("Sweep before TTL dropped %d messages, want 0", n)
+	}
+
+	clock.Advance(30 * time.Minute)
+	if n := s.Sweep(); n != 2 {
+		t.Fatalf("Sweep after TTL dropped %d messages, want 2", n)
+	}
+
+	got := chatMessages(s, 1)
+	if len(got) != 1 || got[0].Content != "new" {
+		t.Fatalf("chat 1 kept %+v, want only the new message", got)
+	}
+	if got := chatMessages(s, 2); got != nil {
+		t.Fatalf("chat 2 kept %+v, want it removed", got)
+	}
+
+	st := s.Stats()
+	if st.Chats != 1 || st.Messages != 1 || st.ExpiredEvictions != 2 {
+		t.Fatalf("Stats() = %+v, want 1 chat, 1 message, 2 expired evictions", st)
+	}
+}
+
+func TestJanitorSweepsOnInterval(t *testing.T) {
+	s, clock := newTestStore(Options{TTL: time.Hour})
+	addMessage(s, clock, 1, "old")
+	clock.Advance(2 * time.Hour)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.RunJanitor(ctx, time.Millisecond)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	for s.Stats().ExpiredEvictions == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("janitor did not sweep the expired message")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	if st := s.Stats(); st.Chats != 0 || st.Messages != 0 {
+		t.Fatalf("Stats() = %+v, want an empty store", st)
+	}
+}
+
+func TestFreshMessagesHonoursTTL(t *testing.T) {
+	s, clock := newTestStore(Options{})
+
+	addMessage(s, clock, 1, "first")
+	clock.Advance(2 * time.Hour)
+	addMessage(s, clock, 1, "second")
+
+	got := s.FreshMessages(1, 10, time.Hour)
+	if len(got) != 1 || got[0].Content != "second" {
+		t.Fatalf("FreshMessages() = %+v, want only the second message", got)
+	}
+}
+
+func TestChatCapKeepsNewestMessages(t *testing.T) {
+	s, clock := newTestStore(Options{MaxMessagesPerChat: 2})
+
+	for _, content := range []string{"a", "b", "c"} {
+		addMessage(s, clock, 1, content)
+	}
+
+	got := chatMessages(s, 1)
+	if len(got) != 2 || got[0].Content != "b" || got[1].Content != "c" {
+		t.Fatalf("messages = %+v, want b and c", got)
+	}
+	if st := s.Stats(); st.Messages != 2 || st.ChatCapEvictions != 1 {
+		t.Fatalf("Stats() = %+v, want 2 messages and 1 chat cap eviction", st)
+	}
+}
+
+func TestGlobalCapEvictsLeastRecentlyUsedChat(t *testing.T) {
+	s, clock := newTestStore(Options{MaxMessages: 3})
+
+	addMessage(s, clock, 1, "one")
+	addMessage(s, clock, 2, "two")
+	addMessage(s, clock, 3, "three")
+
+	// reading chat 1 makes chat 2 the least recently used
+	clock.Advance(time.Minute)
+	s.FreshMessages(1, 10, time.Hour)
+
+	addMessage(s, clock, 4, "four")
+	if got := chatMessages(s, 2); got != nil {
+		t.Fatalf("chat 2 kept %+v, want it evicted", got)
+	}
+	for _, chatID := range []int64{1, 3, 4} {
+		if got := chatMessages(s, chatID); len(got) != 1 {
+			t.Fatalf("chat %d kept %d messages, want 1", chatID, len(got))
+		}
+	}
+
+	addMessage(s, clock, 4, "four again")
+	if got := chatMessages(s, 3); got != nil {
+		t.Fatalf("chat 3 kept %+v, want it evicted", got)
+	}
+
+	st := s.Stats()
+	if st.Chats != 2 || st.Messages != 3 || st.IdleChatEvictions != 2 {
+		t.Fatalf("Stats() = %+v, want 2 chats, 3 messages, 2 idle chat evictions", st)
+	}
+}
+
+func TestGlobalCapNeverEvictsWritingChat(t *testing.T) {
+	s, clock := newTestStore(Options{MaxMessages: 2})
+
+	for _, content := range []string{"a", "b", "c"} {
+		addMessage(s, clock, 1, content)
+	}
+
+	if got := chatMessages(s, 1); len(got) != 3 {
+		t.Fatalf("chat kept %d messages, want 3", len(got))
+	}
+	if st := s.Stats(); st.IdleChatEvictions != 0 {
+		t.Fatalf("Stats() = %+v, want no idle chat evictions", st)
+	}
+}
+
+func TestSweepExpiresSummaries(t *testing.T) {
+	s, clock := newTestStore(Options{TTL: time.Hour})
+
+	addMessage(s, clock, 1, "folded")
+	clock.Advance(30 * time.Minute)
+	s.SaveSummary(1, domain.Summary{Content: "the user prefers Go", UpdatedAt: clock.Now()})
+
+	clock.Advance(40 * time.Minute)
+	if n := s.Sweep(); n != 1 {
+		t.Fatalf("Sweep() dropped %d messages, want 1", n)
+	}
+	if got := s.Summary(1); got.Content != "the user prefers Go" {
+		t.Fatalf("Summary() = %+v, want it kept after the turns expired", got)
+	}
+	if st := s.Stats(); st.Chats != 1 || st.Messages != 0 {
+		t.Fatalf("Stats() = %+v, want only the summarized chat left", st)
+	}
+
+	clock.Advance(30 * time.Minute)
+	s.Sweep()
+	if got := s.Summary(1); got.Content != "" {
+		t.Fatalf("Summary() = %+v, want it expired", got)
+	}
+	if st := s.Stats(); st.Chats != 0 {
+		t.Fatalf("Stats() = %+v, want the summary-only chat removed", st)
+	}
+}
@@ -0,0 +1,96 @@
+package memory
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"chatgpt-telegram-bot/internal/domain"
+)
+
+// usageRetention keeps enough records for monthly totals.
+const usageRetention = 32 * 24 * time.Hour
+
+type UsageLedger struct {
+	mu      sync.Mutex
+	records []domain.UsageRecord
+	now     func() time.Time
+}
+
+func NewUsageLedger() *UsageLedger {
+	return &UsageLedger{now: time.Now}
+}
+
+func (l *UsageLedger) Record(rec domain.UsageRecord) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.records = append(l.records, rec)
+
+	cutoff := l.now().Add(-usageRetention)
+	drop := 0
+	for drop < len(l.records) && l.records[drop].Timestamp.Before(cutoff) {
+		drop++
+	}
+	if drop > 0 {
+		l.records = append([]domain.UsageRecord(nil), l.records[drop:]...)
+	}
+}
+
+func (l *UsageLedger) Totals(filter domain.UsageFilter) domain.UsageTotals {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var totals domain.UsageTotals
+	for _, rec := range l.records {
+		if rec.Timestamp.Before(filter.Since) ||
+			(filter.UserID != 0 && rec.UserID != filter.UserID) ||
+			(filter.ChatID != 0 && rec.ChatID != filter.ChatID) {
+			continue
+		}
+		addUsage(&totals, rec)
+	}
+	return totals
+}
+
+func (l *UsageLedger) TopUsers(since time.Time, limit int) []domain.UserUsage {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	byUser := make(map[int64]*domain.UserUsage)
+	for _, rec := range l.records {
+		if rec.Timestamp.Before(since) {
+			continue
+		}
+		u, ok := byUser[rec.UserID]
+		if !ok {
+			u = &domain.UserUsage{UserID: rec.UserID}
+			byUser[rec.UserID] = u
+		}
+		addUsage(&u.UsageTotals, rec)
+	}
+
+	res := make([]domain.UserUsage, 0, len(byUser))
+	for _, u := range byUser {
+		res = append(res, *u)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Cost != res[j].Cost {
+			return res[i].Cost > res[j].Cost
+		}
+		return res[i].Requests > res[j].Requests
+	})
+	if limit > 0 && len(res) > limit {
+		res = res[:limit]
+	}
+	return res
+}
+
+func addUsage(t *domain.UsageTotals, rec domain.UsageRecord) {
+	t.Requests++
+	t.PromptTokens += rec.PromptTokens
+	t.CompletionTokens += rec.CompletionTokens
+	t.TTSChars += rec.TTSChars
+	t.Images += rec.Images
+	t.Cost += rec.Cost
+}
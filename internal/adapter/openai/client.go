@@ -4,44 +4,140 @@ import (
 	"context"
 	"errors"
 	"io"
+	"math"
 	"strings"
 
 	openaiapi "github.com/sashabaranov/go-openai"
 
+	"chatgpt-telegram-bot/internal/config"
 	"chatgpt-telegram-bot/internal/usecase/chat"
 	"chatgpt-telegram-bot/internal/usecase/tts"
 )
 
 type Client struct {
-	api   *openaiapi.Client
-	token string
+	api  *openaiapi.Client
+	http httpDoer
+	cfg  config.Config
 }
 
-func NewClient(token string) *Client {
+func NewClient(cfg config.Config) *Client {
+	doer := newHTTPDoer(cfg.OpenAITimeout, cfg.OpenAIProject)
+
+	var apiCfg openaiapi.ClientConfig
+	if cfg.OpenAIAPIType == "azure" {
+		apiCfg = openaiapi.DefaultAzureConfig(cfg.OpenAIKey, cfg.OpenAIBaseURL)
+		apiCfg.APIVersion = cfg.OpenAIAPIVersion
+		// configured model names are the Azure deployment names
+		apiCfg.AzureModelMapperFunc = func(model string) string { return model }
+	} else {
+		apiCfg = openaiapi.DefaultConfig(cfg.OpenAIKey)
+		apiCfg.BaseURL = cfg.OpenAIBaseURL
+		apiCfg.OrgID = cfg.OpenAIOrgID
+	}
+	apiCfg.HTTPClient = doer
+
 	return &Client{
-		api:   openaiapi.NewClient(token),
-		token: token,
+		api:  openaiapi.NewClientWithConfig(apiCfg),
+		http: doer,
+		cfg:  cfg,
 	}
 }
 
-func (c *Client) Complete(ctx context.Context, req chat.CompletionRequest) (string, error) {
-	apiReq := openaiapi.ChatCompletionRequest{
-		Model:               req.Model,
-		MaxCompletionTokens: req.MaxCompletionTokens,
-		Stream:              false,
-		Messages:            toAPIMessages(req.Messages),
+func (c *Client) Complete(ctx context.Context, req chat.CompletionRequest) (chat.Completion, error) {
+	ctx, retryAfter := withRetryAfter(ctx)
+	resp, err := c.api.CreateChatCompletion(ctx, toAPIRequest(req, false))
+	if err != nil {
+		return chat.Completion{}, classify(err, *retryAfter)
+	}
+
+	if len(resp.Choices) == 0 {
+		return chat.Completion{}, errors.New("openai returned empty response")
 	}
 
-	resp, err := c.api.CreateChatCompletion(ctx, apiReq)
+	choice := resp.Choices[0]
+	return chat.Completion{
+		Text:      choice.Message.Content,
+		ToolCalls: fromAPIToolCalls(choice.Message.ToolCalls),
+		Usage:     fromAPIUsage(resp.Usage),
+		Truncated: choice.FinishReason == openaiapi.FinishReasonLength,
+	}, nil
+}
+
+func (c *Client) CompleteStream(ctx context.Context, req chat.CompletionRequest, onDelta func(delta string) error) (chat.Completion, error) {
+	ctx, retryAfter := withRetryAfter(ctx)
+	stream, err := c.api.CreateChatCompletionStream(ctx, toAPIRequest(req, true))
 	if err != nil {
-		return "", err
+		return chat.Completion{}, classify(err, *retryAfter)
+	}
+	defer stream.Close()
+
+	var (
+		sb        strings.Builder
+		calls     toolCallAccumulator
+		usage     chat.Usage
+		truncated bool
+	)
+	for {
+		chunk, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return chat.Completion{}, classify(err, 0)
+		}
+		if chunk.Usage != nil {
+			usage = fromAPIUsage(*chunk.Usage)
+		}
+		if len(chunk.Choices) == 0 {
+			continue
+		}
+		if chunk.Choices[0].FinishReason == openaiapi.FinishReasonLength {
+			truncated = true
+		}
+		delta := chunk.Choices[0].Delta
+		calls.add(delta.ToolCalls)
+		if delta.Content == "" {
+			continue
+		}
+		sb.WriteString(delta.Content)
+		if err := onDelta(delta.Content); err != nil {
+			return chat.Completion{}, err
+		}
 	}
 
-	if len(resp.Choices) == 0 {
-		return "", errors.New("openai returned empty response")
+	toolCalls := calls.result()
+	if sb.Len() == 0 && len(toolCalls) == 0 {
+		return chat.Completion{}, errors.New("openai returned empty response")
 	}
 
-	return resp.Choices[0].Message.Content, nil
+	return chat.Completion{
+		Text:      sb.String(),
+		ToolCalls: toolCalls,
+		Usage:     usage,
+		Truncated: truncated,
+	}, nil
+}
+
+func toAPIRequest(req chat.CompletionRequest, stream bool) openaiapi.ChatCompletionRequest {
+	apiReq := openaiapi.ChatCompletionRequest{
+		Model:               req.Model,
+		MaxCompletionTokens: req.MaxCompletionTokens,
+		Stream:              stream,
+		Messages:            toAPIMessages(req.Messages),
+		Tools:               toAPITools(req.Tools),
+	}
+	if req.Temperature != nil {
+		// go-openai omits a zero temperature, which the API reads as 1
+		apiReq.Temperature = max(*req.Temperature, math.SmallestNonzeroFloat32)
+	}
+	if stream {
+		// the final chunk then carries token usage
+		apiReq.StreamOptions = &openaiapi.StreamOptions{IncludeUsage: true}
+	}
+	if req.ToolChoice != "" && len(apiReq.Tools) > 0 {
+		apiReq.ToolChoice = req.ToolChoice
+	}
+	return apiReq
 }
 
 func (c *Client) Speech(ctx context.Context, req tts.Request) (tts.Response, error) {
@@ -59,9 +155,10 @@ func (c *Client) Speech(ctx context.Context, req tts.Request) (tts.Response, err
 		apiReq.ResponseFormat = openaiapi.SpeechResponseFormat(req.Format)
 	}
 
+	ctx, retryAfter := withRetryAfter(ctx)
 	raw, err := c.api.CreateSpeech(ctx, apiReq)
 	if err != nil {
-		return tts.Response{}, err
+		return tts.Response{}, classify(err, *retryAfter)
 	}
 	defer raw.Close()
 
@@ -76,13 +173,22 @@ func (c *Client) Speech(ctx context.Context, req tts.Request) (tts.Response, err
 	}, nil
 }
 
+func fromAPIUsage(u openaiapi.Usage) chat.Usage {
+	return chat.Usage{
+		PromptTokens:     u.PromptTokens,
+		CompletionTokens: u.CompletionTokens,
+	}
+}
+
 func toAPIMessages(msgs []chat.Message) []openaiapi.ChatCompletionMessage {
 	res := make([]openaiapi.ChatCompletionMessage, 0, len(msgs))
 	for _, m := range msgs {
 		if len(m.Images) == 0 {
 			res = append(res, openaiapi.ChatCompletionMessage{
-				Role:    m.Role,
-				Content: m.Text,
+				Role:       m.Role,
+				Content:    m.Text,
+				ToolCalls:  toAPIToolCalls(m.ToolCalls),
+				ToolCallID: m.ToolCallID,
 			})
 			continue
 		}
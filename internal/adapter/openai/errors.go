@@ -0,0 +1,97 @@
+package openai
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	openaiapi "github.com/sashabaranov/go-openai"
+
+	"chatgpt-telegram-bot/internal/domain"
+	"chatgpt-telegram-bot/internal/usecase/chat"
+)
+
+type retryAfterKey struct{}
+
+// withRetryAfter returns a context under which the HTTP layer records the
+// Retry-After hint of a failed response into the returned duration.
+func withRetryAfter(ctx context.Context) (context.Context, *time.Duration) {
+	after := new(time.Duration)
+	return context.WithValue(ctx, retryAfterKey{}, after), after
+}
+
+func parseRetryAfter(h http.Header, now time.Time) time.Duration {
+	if ms, err := strconv.Atoi(strings.TrimSpace(h.Get("Retry-After-Ms"))); err == nil && ms > 0 {
+		return time.Duration(ms) * time.Millisecond
+	}
+	value := strings.TrimSpace(h.Get("Retry-After"))
+	if value == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(value); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil && at.After(now) {
+		return at.Sub(now)
+	}
+	return 0
+}
+
+// classify wraps err in a domain.ProviderError describing what went wrong.
+func classify(err error, retryAfter time.Duration) error {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return err
+	}
+
+	perr := &domain.ProviderError{Err: err, RetryAfter: retryAfter}
+
+	var (
+		apiErr *openaiapi.APIError
+		reqErr *openaiapi.RequestError
+		netErr net.Error
+		urlErr *url.Error
+	)
+	switch {
+	case errors.As(err, &apiErr):
+		code, _ := apiErr.Code.(string)
+		perr.Kind, perr.Retryable = classifyStatus(apiErr.HTTPStatusCode, code, apiErr.Type)
+	case errors.As(err, &reqErr):
+		perr.Kind, perr.Retryable = classifyStatus(reqErr.HTTPStatusCode, "", "")
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		perr.Kind, perr.Retryable = domain.ErrTimeout, true
+	case errors.As(err, &urlErr):
+		perr.Kind, perr.Retryable = domain.ErrUnavailable, true
+	default:
+		return err
+	}
+	if perr.Kind == nil {
+		return err
+	}
+	return perr
+}
+
+func classifyStatus(status int, code, typ string) (error, bool) {
+	switch {
+	case code == "context_length_exceeded":
+		return chat.ErrContextTooLong, false
+	case code == "content_policy_violation", code == "content_filter", typ == "content_filter",
+		code == "moderation_blocked":
+		return domain.ErrContentPolicy, false
+	case code == "insufficient_quota":
+		return domain.ErrRateLimited, false
+	case status == http.StatusUnauthorized, status == http.StatusForbidden:
+		return domain.ErrUnauthorized, false
+	case status == http.StatusTooManyRequests:
+		return domain.ErrRateLimited, true
+	case status == http.StatusRequestTimeout, status == http.StatusGatewayTimeout:
+		return domain.ErrTimeout, true
+	case status == http.StatusConflict, status >= 500:
+		return domain.ErrUnavailable, true
+	}
+	return nil, false
+}
@@ -0,0 +1,90 @@
+package openai
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	openaiapi "github.com/sashabaranov/go-openai"
+
+	"chatgpt-telegram-bot/internal/domain"
+	"chatgpt-telegram-bot/internal/usecase/chat"
+)
+
+func TestClassifyStatus(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    int
+		code      string
+		typ       string
+		wantKind  error
+		retryable bool
+	}{
+		{"context too long", http.StatusBadRequest, "context_length_exceeded", "", chat.ErrContextTooLong, false},
+		{"content policy", http.StatusBadRequest, "content_policy_violation", "", domain.ErrContentPolicy, false},
+		{"content filter code", http.StatusBadRequest, "content_filter", "", domain.ErrContentPolicy, false},
+		{"content filter type", http.StatusBadRequest, "", "content_filter", domain.ErrContentPolicy, false},
+		{"moderation", http.StatusBadRequest, "moderation_blocked", "", domain.ErrContentPolicy, false},
+		{"quota exhausted", http.StatusTooManyRequests, "insufficient_quota", "", domain.ErrRateLimited, false},
+		{"unauthorized", http.StatusUnauthorized, "", "", domain.ErrUnauthorized, false},
+		{"forbidden", http.StatusForbidden, "", "", domain.ErrUnauthorized, false},
+		{"rate limited", http.StatusTooManyRequests, "rate_limit_exceeded", "", domain.ErrRateLimited, true},
+		{"request timeout", http.StatusRequestTimeout, "", "", domain.ErrTimeout, true},
+		{"gateway timeout", http.StatusGatewayTimeout, "", "", domain.ErrTimeout, true},
+		{"conflict", http.StatusConflict, "", "", domain.ErrUnavailable, true},
+		{"server error", http.StatusInternalServerError, "", "", domain.ErrUnavailable, true},
+		{"overloaded", http.StatusServiceUnavailable, "", "", domain.ErrUnavailable, true},
+		{"bad request", http.StatusBadRequest, "invalid_value", "", nil, false},
+		{"not found", http.StatusNotFound, "", "", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kind, retryable := classifyStatus(tt.status, tt.code, tt.typ)
+			if kind != tt.wantKind || retryable != tt.retryable {
+				t.Fatalf("classifyStatus() = %v, %v; want %v, %v", kind, retryable, tt.wantKind, tt.retryable)
+			}
+		})
+	}
+}
+
+func TestClassifyKeepsRetryAfter(t *testing.T) {
+	err := classify(&openaiapi.APIError{HTTPStatusCode: http.StatusTooManyRequests}, 3*time.Second)
+
+	var perr *domain.ProviderError
+	if !errors.As(err, &perr) {
+		t.Fatalf("classify() = %v, want a provider error", err)
+	}
+	if !errors.Is(err, domain.ErrRateLimited) || !perr.Retryable || perr.RetryAfter != 3*time.Second {
+		t.Fatalf("classify() = %+v, want a retryable rate limit after 3s", perr)
+	}
+
+	plain := errors.New("boom")
+	if got := classify(plain, 0); got != plain {
+		t.Fatalf("classify(plain) = %v, want it unchanged", got)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		header http.Header
+		want   time.Duration
+	}{
+		{"none", http.Header{}, 0},
+		{"seconds", http.Header{"Retry-After": {"7"}}, 7 * time.Second},
+		{"milliseconds win", http.Header{"Retry-After": {"7"}, "Retry-After-Ms": {"250"}}, 250 * time.Millisecond},
+		{"http date", http.Header{"Retry-After": {now.Add(90 * time.Second).Format(http.TimeFormat)}}, 90 * time.Second},
+		{"date in the past", http.Header{"Retry-After": {now.Add(-time.Minute).Format(http.TimeFormat)}}, 0},
+		{"garbage", http.Header{"Retry-After": {"soon"}}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseRetryAfter(tt.header, now); got != tt.want {
+				t.Fatalf("parseRetryAfter() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
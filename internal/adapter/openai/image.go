@@ -9,26 +9,45 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"strings"
+	"time"
+
+	openaiapi "github.com/sashabaranov/go-openai"
 
 	"chatgpt-telegram-bot/internal/usecase/image"
 )
 
-const responsesEndpoint = "https://api.openai.com/v1/responses"
-
 type responsesCreateRequest struct {
-	Model      string               `json:"model"`
-	Input      string               `json:"input"`
+	Model string `json:"model"`
+	// Input is the prompt text, or messages when there are images to edit.
+	Input      any                  `json:"input"`
 	Tools      []responsesImageTool `json:"tools,omitempty"`
 	ToolChoice map[string]string    `json:"tool_choice,omitempty"`
 }
 
+type responsesInputMessage struct {
+	Role    string                  `json:"role"`
+	Content []responsesInputContent `json:"content"`
+}
+
+type responsesInputContent struct {
+	Type     string `json:"type"`
+	Text     string `json:"text,omitempty"`
+	ImageURL string `json:"image_url,omitempty"`
+}
+
 type responsesImageTool struct {
-	Type       string `json:"type"`
-	Size       string `json:"size,omitempty"`
-	Quality    string `json:"quality,omitempty"`
-	Format     string `json:"format,omitempty"`
-	Background string `json:"background,omitempty"`
+	Type           string              `json:"type"`
+	Size           string              `json:"size,omitempty"`
+	Quality        string              `json:"quality,omitempty"`
+	Format         string              `json:"format,omitempty"`
+	Background     string              `json:"background,omitempty"`
+	InputImageMask *responsesImageMask `json:"input_image_mask,omitempty"`
+}
+
+type responsesImageMask struct {
+	ImageURL string `json:"image_url"`
 }
 
 type responsesCreateResponse struct {
@@ -43,6 +62,8 @@ type responsesOutputItem struct {
 
 type responsesError struct {
 	Message string `json:"message"`
+	Type    string `json:"type"`
+	Code    string `json:"code"`
 }
 
 func (c *Client) Generate(ctx context.Context, req image.Request) (image.Response, error) {
@@ -57,10 +78,13 @@ func (c *Client) Generate(ctx context.Context, req image.Request) (image.Respons
 		Format:     strings.TrimSpace(req.Format),
 		Background: strings.TrimSpace(req.Background),
 	}
+	if req.Mask != "" {
+		tool.InputImageMask = &responsesImageMask{ImageURL: req.Mask}
+	}
 
 	createReq := responsesCreateRequest{
 		Model:      req.Model,
-		Input:      req.Prompt,
+		Input:      imageInput(req),
 		Tools:      []responsesImageTool{tool},
 		ToolChoice: map[string]string{"type": "image_generation"},
 	}
@@ -70,16 +94,14 @@ func (c *Client) Generate(ctx context.Context, req image.Request) (image.Respons
 		return image.Response{}, err
 	}
 
-	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, responsesEndpoint, bytes.NewReader(body))
+	httpReq, err := c.newResponsesRequest(ctx, body)
 	if err != nil {
 		return image.Response{}, err
 	}
-	httpReq.Header.Set("Authorization", "Bearer "+c.token)
-	httpReq.Header.Set("Content-Type", "application/json")
 
-	resp, err := http.DefaultClient.Do(httpReq)
+	resp, err := c.http.Do(httpReq)
 	if err != nil {
-		return image.Response{}, err
+		return image.Response{}, classify(err, 0)
 	}
 	defer resp.Body.Close()
 
@@ -89,11 +111,18 @@ func (c *Client) Generate(ctx context.Context, req image.Request) (image.Respons
 	}
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		var apiErr responsesCreateResponse
-		if json.Unmarshal(respBody, &apiErr) == nil && apiErr.Error != nil && apiErr.Error.Message != "" {
-			return image.Response{}, fmt.Errorf("openai error: %s", apiErr.Error.Message)
+		apiErr := &openaiapi.APIError{
+			Message:        fmt.Sprintf("status %d", resp.StatusCode),
+			HTTPStatus:     resp.Status,
+			HTTPStatusCode: resp.StatusCode,
+		}
+		var errResp responsesCreateResponse
+		if json.Unmarshal(respBody, &errResp) == nil && errResp.Error != nil && errResp.Error.Message != "" {
+			apiErr.Message = errResp.Error.Message
+			apiErr.Type = errResp.Error.Type
+			apiErr.Code = errResp.Error.Code
 		}
-		return image.Response{}, fmt.Errorf("openai error: status %d", resp.StatusCode)
+		return image.Response{}, classify(apiErr, parseRetryAfter(resp.Header, time.Now()))
 	}
 
 	var apiResp responsesCreateResponse
@@ -118,3 +147,42 @@ func (c *Client) Generate(ctx context.Context, req image.Request) (image.Respons
 
 	return image.Response{}, errors.New("no image generation result in response")
 }
+
+// imageInput passes the prompt as plain text, or together with the images to
+// edit as input_image content.
+func imageInput(req image.Request) any {
+	if len(req.Images) == 0 {
+		return req.Prompt
+	}
+	content := []responsesInputContent{{Type: "input_text", Text: req.Prompt}}
+	for _, img := range req.Images {
+		content = append(content, responsesInputContent{Type: "input_image", ImageURL: img})
+	}
+	return []responsesInputMessage{{Role: "user", Content: content}}
+}
+
+// newResponsesRequest builds a Responses API call, which go-openai does not
+// wrap, against the configured endpoint.
+func (c *Client) newResponsesRequest(ctx context.Context, body []byte) (*http.Request, error) {
+	endpoint := c.cfg.OpenAIBaseURL + "/responses"
+	if c.cfg.OpenAIAPIType == "azure" {
+		endpoint = c.cfg.OpenAIBaseURL + "/openai/responses?api-version=" + url.QueryEscape(c.cfg.OpenAIAPIVersion)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.cfg.OpenAIAPIType == "azure" {
+		req.Header.Set("api-key", c.cfg.OpenAIKey)
+		return req, nil
+	}
+	if c.cfg.OpenAIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.cfg.OpenAIKey)
+	}
+	if c.cfg.OpenAIOrgID != "" {
+		req.Header.Set("OpenAI-Organization", c.cfg.OpenAIOrgID)
+	}
+	return req, nil
+}
@@ -0,0 +1,113 @@
+package openai
+
+import (
+	"sort"
+	"strings"
+
+	openaiapi "github.com/sashabaranov/go-openai"
+
+	"chatgpt-telegram-bot/internal/usecase/chat"
+)
+
+func toAPITools(defs []chat.ToolDefinition) []openaiapi.Tool {
+	if len(defs) == 0 {
+		return nil
+	}
+	tools := make([]openaiapi.Tool, 0, len(defs))
+	for _, d := range defs {
+		tools = append(tools, openaiapi.Tool{
+			Type: openaiapi.ToolTypeFunction,
+			Function: &openaiapi.FunctionDefinition{
+				Name:        d.Name,
+				Description: d.Description,
+				Parameters:  d.Parameters,
+			},
+		})
+	}
+	return tools
+}
+
+func toAPIToolCalls(calls []chat.ToolCall) []openaiapi.ToolCall {
+	if len(calls) == 0 {
+		return nil
+	}
+	res := make([]openaiapi.ToolCall, 0, len(calls))
+	for _, c := range calls {
+		res = append(res, openaiapi.ToolCall{
+			ID:   c.ID,
+			Type: openaiapi.ToolTypeFunction,
+			Function: openaiapi.FunctionCall{
+				Name:      c.Name,
+				Arguments: c.Arguments,
+			},
+		})
+	}
+	return res
+}
+
+func fromAPIToolCalls(calls []openaiapi.ToolCall) []chat.ToolCall {
+	if len(calls) == 0 {
+		return nil
+	}
+	res := make([]chat.ToolCall, 0, len(calls))
+	for _, c := range calls {
+		res = append(res, chat.ToolCall{
+			ID:        c.ID,
+			Name:      c.Function.Name,
+			Arguments: c.Function.Arguments,
+		})
+	}
+	return res
+}
+
+// toolCallAccumulator joins streamed tool call fragments, which arrive keyed
+// by index with the id and name only on the first fragment.
+type toolCallAccumulator struct {
+	calls map[int]*chat.ToolCall
+	args  map[int]*strings.Builder
+}
+
+func (a *toolCallAccumulator) add(deltas []openaiapi.ToolCall) {
+	for i, d := range deltas {
+		idx := i
+		if d.Index != nil {
+			idx = *d.Index
+		}
+		if a.calls == nil {
+			a.calls = make(map[int]*chat.ToolCall)
+			a.args = make(map[int]*strings.Builder)
+		}
+		call, ok := a.calls[idx]
+		if !ok {
+			call = &chat.ToolCall{}
+			a.calls[idx] = call
+			a.args[idx] = &strings.Builder{}
+		}
+		if d.ID != "" {
+			call.ID = d.ID
+		}
+		if d.Function.Name != "" {
+			call.Name = d.Function.Name
+		}
+		a.args[idx].WriteString(d.Function.Arguments)
+	}
+}
+
+func (a *toolCallAccumulator) result() []chat.ToolCall {
+	if len(a.calls) == 0 {
+		return nil
+	}
+	indexes := make([]int, 0, len(a.calls))
+	for idx := range a.calls {
+		indexes = append(indexes, idx)
+	}
+	sort.Ints(indexes)
+
+	res := make([]chat.ToolCall, 0, len(indexes))
+	for _, idx := range indexes {
+		call := *a.calls[idx]
+		call.Arguments = a.args[idx].String()
+		res = append(res, call)
+	}
+	return res
+}
@@ -0,0 +1,40 @@
+package openai
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"strings"
+
+	openaiapi "github.com/sashabaranov/go-openai"
+
+	"chatgpt-telegram-bot/internal/usecase/transcribe"
+)
+
+func (c *Client) Transcribe(ctx context.Context, req transcribe.Request) (string, error) {
+	ctx, retryAfter := withRetryAfter(ctx)
+	resp, err := c.api.CreateTranscription(ctx, openaiapi.AudioRequest{
+		Model:    req.Model,
+		FilePath: transcriptionFileName(req.FileName),
+		Reader:   bytes.NewReader(req.Data),
+		Language: strings.TrimSpace(req.Language),
+		Format:   openaiapi.AudioResponseFormatJSON,
+	})
+	if err != nil {
+		return "", classify(err, *retryAfter)
+	}
+	return strings.TrimSpace(resp.Text), nil
+}
+
+// transcriptionFileName maps Telegram's .oga voice notes to an extension the
+// transcription endpoint accepts; the format is detected from the name.
+func transcriptionFileName(name string) string {
+	name = filepath.Base(name)
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".oga", ".opus":
+		return strings.TrimSuffix(name, filepath.Ext(name)) + ".ogg"
+	case "":
+		return name + ".ogg"
+	}
+	return name
+}
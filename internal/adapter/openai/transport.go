@@ -0,0 +1,50 @@
+package openai
+
+import (
+	"net"
+	"net/http"
+	"time"
+)
+
+// httpDoer is the HTTP layer shared by every call of a Client. It adds the
+// project header, which go-openai has no option for, and captures
+// Retry-After hints, which go-openai drops when it turns a response into an
+// error.
+type httpDoer struct {
+	client  *http.Client
+	project string
+}
+
+func newHTTPDoer(timeout time.Duration, project string) httpDoer {
+	dialer := &net.Dialer{Timeout: 10 * time.Second, KeepAlive: 30 * time.Second}
+	return httpDoer{
+		client: &http.Client{
+			Timeout: timeout,
+			Transport: &http.Transport{
+				Proxy:                 http.ProxyFromEnvironment,
+				DialContext:           dialer.DialContext,
+				ForceAttemptHTTP2:     true,
+				MaxIdleConns:          100,
+				MaxIdleConnsPerHost:   16,
+				IdleConnTimeout:       90 * time.Second,
+				TLSHandshakeTimeout:   10 * time.Second,
+				ExpectContinueTimeout: time.Second,
+			},
+		},
+		project: project,
+	}
+}
+
+func (d httpDoer) Do(req *http.Request) (*http.Response, error) {
+	if d.project != "" {
+		req.Header.Set("OpenAI-Project", d.project)
+	}
+	resp, err := d.client.Do(req)
+	if err != nil || resp.StatusCode < 400 {
+		return resp, err
+	}
+	if after, ok := req.Context().Value(retryAfterKey{}).(*time.Duration); ok {
+		*after = parseRetryAfter(resp.Header, time.Now())
+	}
+	return resp, err
+}
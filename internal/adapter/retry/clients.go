@@ -0,0 +1,78 @@
+package retry
+
+import (
+	"context"
+
+	"chatgpt-telegram-bot/internal/usecase/chat"
+	"chatgpt-telegram-bot/internal/usecase/image"
+	"chatgpt-telegram-bot/internal/usecase/tts"
+)
+
+type ChatClient struct {
+	next   chat.Client
+	policy Policy
+}
+
+func NewChatClient(next chat.Client, policy Policy) *ChatClient {
+	return &ChatClient{next: next, policy: policy}
+}
+
+func (c *ChatClient) Complete(ctx context.Context, req chat.CompletionRequest) (chat.Completion, error) {
+	return Do(ctx, c.policy, func(ctx context.Context) (chat.Completion, error) {
+		return c.next.Complete(ctx, req)
+	})
+}
+
+// CompleteStream retries only until the first delta has been delivered;
+// after that a retry would repeat text the caller has already shown.
+func (c *ChatClient) CompleteStream(ctx context.Context, req chat.CompletionRequest, onDelta func(delta string) error) (chat.Completion, error) {
+	streamer, ok := c.next.(chat.StreamingClient)
+	if !ok {
+		resp, err := c.Complete(ctx, req)
+		if err != nil || resp.Text == "" {
+			return resp, err
+		}
+		return resp, onDelta(resp.Text)
+	}
+
+	for attempt := 0; ; attempt++ {
+		started := false
+		resp, err := streamer.CompleteStream(ctx, req, func(delta string) error {
+			started = true
+			return onDelta(delta)
+		})
+		if err == nil || started || !c.policy.wait(ctx, attempt, err) {
+			return resp, err
+		}
+	}
+}
+
+type SpeechClient struct {
+	next   tts.Client
+	policy Policy
+}
+
+func NewSpeechClient(next tts.Client, policy Policy) *SpeechClient {
+	return &SpeechClient{next: next, policy: policy}
+}
+
+func (c *SpeechClient) Speech(ctx context.Context, req tts.Request) (tts.Response, error) {
+	return Do(ctx, c.policy, func(ctx context.Context) (tts.Response, error) {
+		return c.next.Speech(ctx, req)
+	})
+}
+
+type ImageClient struct {
+	next   image.Client
+	policy Policy
+}
+
+func NewImageClient(next image.Client, policy Policy) *ImageClient {
+	return &ImageClient{next: next, policy: policy}
+}
+
+func (c *ImageClient) Generate(ctx context.Context, req image.Request) (image.Response, error) {
+	return Do(ctx, c.policy, func(ctx context.Context) (image.Response, error) {
+		return c.next.Generate(ctx, req)
+	})
+}
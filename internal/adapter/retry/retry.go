@@ -0,0 +1,73 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math/rand/v2"
+	"time"
+
+	"chatgpt-telegram-bot/internal/config"
+	"chatgpt-telegram-bot/internal/domain"
+)
+
+// Policy retries retryable provider errors with exponential backoff and
+// jitter, honouring Retry-After hints that fit within MaxDelay.
+type Policy struct {
+	MaxRetries int
+	BaseDelay  time.Duration
+	MaxDelay   time.Duration
+}
+
+func PolicyFromConfig(cfg config.Config) Policy {
+	return Policy{
+		MaxRetries: cfg.MaxRetries,
+		BaseDelay:  cfg.RetryBaseDelay,
+		MaxDelay:   cfg.RetryMaxDelay,
+	}
+}
+
+// Do calls fn until it succeeds, fails permanently or runs out of retries.
+func Do[T any](ctx context.Context, p Policy, fn func(ctx context.Context) (T, error)) (T, error) {
+	for attempt := 0; ; attempt++ {
+		res, err := fn(ctx)
+		if err == nil || !p.wait(ctx, attempt, err) {
+			return res, err
+		}
+	}
+}
+
+// wait sleeps before the next attempt and reports whether there should be one.
+func (p Policy) wait(ctx context.Context, attempt int, err error) bool {
+	delay, ok := p.delay(attempt, err)
+	if !ok {
+		return false
+	}
+	log.Printf("provider request failed, retry %d/%d in %s: %v", attempt+1, p.MaxRetries, delay.Round(time.Millisecond), err)
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+func (p Policy) delay(attempt int, err error) (time.Duration, bool) {
+	var perr *domain.ProviderError
+	if attempt >= p.MaxRetries || !errors.As(err, &perr) || !perr.Retryable {
+		return 0, false
+	}
+	if perr.RetryAfter > 0 {
+		return perr.RetryAfter, perr.RetryAfter <= p.MaxDelay
+	}
+
+	backoff := p.BaseDelay << attempt
+	if backoff <= 0 || backoff > p.MaxDelay {
+		backoff = p.MaxDelay
+	}
+	half := backoff / 2
+	return half + rand.N(half+1), true
+}
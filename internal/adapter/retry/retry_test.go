@@ -0,0 +1,94 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"chatgpt-telegram-bot/internal/domain"
+)
+
+func providerError(retryable bool, retryAfter time.Duration) error {
+	return &domain.ProviderError{
+		Kind:       domain.ErrUnavailable,
+		Retryable:  retryable,
+		RetryAfter: retryAfter,
+		Err:        errors.New("upstream failed"),
+	}
+}
+
+func TestPolicyDelay(t *testing.T) {
+	p := Policy{MaxRetries: 3, BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+
+	tests := []struct {
+		name    string
+		policy  Policy
+		attempt int
+		err     error
+		wantOK  bool
+		min     time.Duration
+		max     time.Duration
+	}{
+		{"plain error", p, 0, errors.New("boom"), false, 0, 0},
+		{"permanent failure", p, 0, providerError(false, 0), false, 0, 0},
+		{"out of retries", p, 3, providerError(true, 0), false, 0, 0},
+		{"retry after", p, 0, providerError(true, 300*time.Millisecond), true, 300 * time.Millisecond, 300 * time.Millisecond},
+		{"retry after at the cap", p, 2, providerError(true, time.Second), true, time.Second, time.Second},
+		{"retry after beyond the cap", p, 0, providerError(true, 2*time.Second), false, 0, 0},
+		{"first backoff", p, 0, providerError(true, 0), true, 50 * time.Millisecond, 100 * time.Millisecond},
+		{"third backoff", p, 2, providerError(true, 0), true, 200 * time.Millisecond, 400 * time.Millisecond},
+		{"backoff capped", Policy{MaxRetries: 10, BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second},
+			5, providerError(true, 0), true, 500 * time.Millisecond, time.Second},
+		{"backoff overflow capped", Policy{MaxRetries: 100, BaseDelay: time.Second, MaxDelay: time.Minute},
+			70, providerError(true, 0), true, 30 * time.Second, time.Minute},
+		{"wrapped error", p, 0, errors.Join(errors.New("context"), providerError(true, 0)), true, 50 * time.Millisecond, 100 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the jitter is random, so sample a few times
+			for range 20 {
+				got, ok := tt.policy.delay(tt.attempt, tt.err)
+				if ok != tt.wantOK {
+					t.Fatalf("delay() ok = %v, want %v", ok, tt.wantOK)
+				}
+				if ok && (got < tt.min || got > tt.max) {
+					t.Fatalf("delay() = %s, want between %s and %s", got, tt.min, tt.max)
+				}
+			}
+		})
+	}
+}
+
+func TestDoRetriesUntilSuccess(t *testing.T) {
+	p := Policy{MaxRetries: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}
+
+	calls := 0
+	got, err := Do(context.Background(), p, func(context.Context) (string, error) {
+		calls++
+		if calls < 3 {
+			return "", providerError(true, 0)
+		}
+		return "ok", nil
+	})
+	if err != nil || got != "ok" {
+		t.Fatalf("Do() = %q, %v; want ok", got, err)
+	}
+	if calls != 3 {
+		t.Fatalf("fn called %d times, want 3", calls)
+	}
+}
+
+func TestDoStopsOnPermanentError(t *testing.T) {
+	p := Policy{MaxRetries: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}
+
+	calls := 0
+	want := providerError(false, 0)
+	_, err := Do(context.Background(), p, func(context.Context) (string, error) {
+		calls++
+		return "", want
+	})
+	if !errors.Is(err, want) || calls != 1 {
+		t.Fatalf("Do() error = %v after %d calls, want the permanent error after 1", err, calls)
+	}
+}
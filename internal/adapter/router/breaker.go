@@ -0,0 +1,69 @@
+package router
+
+import (
+	"sync"
+	"time"
+)
+
+// breaker stops sending requests to a backend after repeated failures. Once
+// the cooldown has passed it lets a single trial request through; its outcome
+// closes the breaker or opens it for another cooldown.
+type breaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	trial     bool
+}
+
+func newBreaker(threshold int, cooldown time.Duration) *breaker {
+	return &breaker{threshold: threshold, cooldown: cooldown}
+}
+
+// allow reports whether a request may be sent now.
+func (b *breaker) allow(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.threshold <= 0 || b.openUntil.IsZero() {
+		return true
+	}
+	if now.Before(b.openUntil) || b.trial {
+		return false
+	}
+	b.trial = true
+	return true
+}
+
+func (b *breaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures = 0
+	b.openUntil = time.Time{}
+	b.trial = false
+}
+
+// failure records a failed request and reports whether it opened the breaker.
+func (b *breaker) failure(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	if b.threshold <= 0 || (!b.trial && b.failures < b.threshold) {
+		return false
+	}
+	b.trial = false
+	b.openUntil = now.Add(b.cooldown)
+	return true
+}
+
+// release ends a trial whose outcome says nothing about the backend.
+func (b *breaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.trial = false
+}
@@ -0,0 +1,200 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"chatgpt-telegram-bot/internal/config"
+	"chatgpt-telegram-bot/internal/domain"
+	"chatgpt-telegram-bot/internal/usecase/chat"
+)
+
+type backend struct {
+	name     string
+	prefixes []string
+	client   chat.Client
+	breaker  *breaker
+}
+
+func (b *backend) serves(model string) bool {
+	for _, prefix := range b.prefixes {
+		if strings.HasPrefix(model, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// candidate is a model and the backend that would serve it.
+type candidate struct {
+	model   string
+	backend *backend
+}
+
+// Router sends each chat request to the backends serving its model, failing
+// over to the next backend or fallback model when a provider is down.
+// Backends that keep failing are skipped until their breaker cools down.
+type Router struct {
+	backends []*backend
+	routing  config.Routing
+	cfg      config.Config
+	now      func() time.Time
+}
+
+func New(cfg config.Config) *Router {
+	return &Router{
+		routing: cfg.Routing,
+		cfg:     cfg,
+		now:     time.Now,
+	}
+}
+
+// Add registers a backend for models starting with one of prefixes; without
+// prefixes it serves every model no prefixed backend claims. Backends serving
+// the same model are tried in the order they were added.
+func (r *Router) Add(name string, client chat.Client, prefixes ...string) {
+	lower := make([]string, 0, len(prefixes))
+	for _, p := range prefixes {
+		lower = append(lower, strings.ToLower(p))
+	}
+	r.backends = append(r.backends, &backend{
+		name:     name,
+		prefixes: lower,
+		client:   client,
+		breaker:  newBreaker(r.cfg.BreakerFailures, r.cfg.BreakerCooldown),
+	})
+}
+
+// RouteModel applies the first routing rule matching the request.
+func (r *Router) RouteModel(model string, images bool, promptTokens int) string {
+	for _, rule := range r.routing.Rules {
+		if len(rule.Models) > 0 && !slices.Contains(rule.Models, model) {
+			continue
+		}
+		if rule.Images && !images {
+			continue
+		}
+		if rule.MinPromptTokens > 0 && promptTokens < rule.MinPromptTokens {
+			continue
+		}
+		return rule.Model
+	}
+	return model
+}
+
+func (r *Router) Complete(ctx context.Context, req chat.CompletionRequest) (chat.Completion, error) {
+	return r.try(ctx, req, nil, func(client chat.Client, req chat.CompletionRequest) (chat.Completion, error) {
+		return client.Complete(ctx, req)
+	})
+}
+
+// CompleteStream fails over only until the first delta has been delivered.
+func (r *Router) CompleteStream(ctx context.Context, req chat.CompletionRequest, onDelta func(delta string) error) (chat.Completion, error) {
+	started := false
+	forward := func(delta string) error {
+		started = true
+		return onDelta(delta)
+	}
+	return r.try(ctx, req, func() bool { return started }, func(client chat.Client, req chat.CompletionRequest) (chat.Completion, error) {
+		if streamer, ok := client.(chat.StreamingClient); ok {
+			return streamer.CompleteStream(ctx, req, forward)
+		}
+		resp, err := client.Complete(ctx, req)
+		if err != nil || resp.Text == "" {
+			return resp, err
+		}
+		return resp, forward(resp.Text)
+	})
+}
+
+func (r *Router) try(ctx context.Context, req chat.CompletionRequest, started func() bool, call func(chat.Client, chat.CompletionRequest) (chat.Completion, error)) (chat.Completion, error) {
+	var lastErr error
+	for i, c := range r.candidates(req.Model) {
+		if !c.backend.breaker.allow(r.now()) {
+			continue
+		}
+		if i > 0 {
+			log.Printf("failing over to %s on %s", c.model, c.backend.name)
+		}
+
+		attempt := req
+		attempt.Model = c.model
+		resp, err := call(c.backend.client, attempt)
+		switch {
+		case err == nil:
+			c.backend.breaker.success()
+			if resp.Usage.Model == "" {
+				resp.Usage.Model = c.model
+			}
+			return resp, nil
+		case ctx.Err() != nil:
+			c.backend.breaker.release()
+			return resp, err
+		case !providerFailure(err):
+			// the backend answered; the request itself was rejected
+			c.backend.breaker.success()
+			return resp, err
+		}
+
+		if c.backend.breaker.failure(r.now()) {
+			log.Printf("%s marked unhealthy for %s: %v", c.backend.name, r.cfg.BreakerCooldown, err)
+		}
+		lastErr = err
+		if started != nil && started() {
+			return resp, err
+		}
+	}
+
+	if lastErr == nil {
+		lastErr = &domain.ProviderError{
+			Kind: domain.ErrUnavailable,
+			Err:  fmt.Errorf("no healthy backend for model %s", req.Model),
+		}
+	}
+	return chat.Completion{}, lastErr
+}
+
+// candidates lists where to send a request for model in order: the model and
+// then its fallbacks, each on the backends serving it.
+func (r *Router) candidates(model string) []candidate {
+	models := append([]string{model}, r.routing.Fallbacks[model]...)
+
+	var res []candidate
+	for _, m := range models {
+		lower := strings.ToLower(m)
+		claimed := false
+		for _, b := range r.backends {
+			if b.serves(lower) {
+				res = append(res, candidate{model: m, backend: b})
+				claimed = true
+			}
+		}
+		if claimed {
+			continue
+		}
+		for _, b := range r.backends {
+			if len(b.prefixes) == 0 {
+				res = append(res, candidate{model: m, backend: b})
+			}
+		}
+	}
+	return res
+}
+
+// providerFailure reports whether err means the backend itself is failing
+// rather than rejecting this particular request.
+func providerFailure(err error) bool {
+	var perr *domain.ProviderError
+	if !errors.As(err, &perr) {
+		return false
+	}
+	return errors.Is(err, domain.ErrUnavailable) ||
+		errors.Is(err, domain.ErrTimeout) ||
+		errors.Is(err, domain.ErrRateLimited) ||
+		errors.Is(err, domain.ErrUnauthorized)
+}
@@ -0,0 +1,108 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"chatgpt-telegram-bot/internal/config"
+	"chatgpt-telegram-bot/internal/domain"
+	"chatgpt-telegram-bot/internal/usecase/chat"
+)
+
+type fakeClient struct {
+	calls int
+	err   error
+}
+
+func (c *fakeClient) Complete(_ context.Context, req chat.CompletionRequest) (chat.Completion, error) {
+	c.calls++
+	if c.err != nil {
+		return chat.Completion{}, c.err
+	}
+	return chat.Completion{Text: "answer from " + req.Model}, nil
+}
+
+func loadConfig(t *testing.T, env map[string]string) config.Config {
+	t.Helper()
+	t.Setenv("TELEGRAM_BOT_TOKEN", "test-token")
+	t.Setenv("OPENAI_API_KEY", "test-key")
+	for key, value := range env {
+		t.Setenv(key, value)
+	}
+	cfg, err := config.Load(filepath.Join(t.TempDir(), ".env"))
+	if err != nil {
+		t.Fatalf("config.Load() error: %v", err)
+	}
+	return cfg
+}
+
+func TestBreakerTripsWithConfiguredThreshold(t *testing.T) {
+	cfg := loadConfig(t, map[string]string{
+		"BREAKER_FAILURES":     "2",
+		"BREAKER_COOLDOWN_SEC": "60",
+	})
+	cfg.Routing.Fallbacks = map[string][]string{"claude-x": {"gpt-x"}}
+
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	primary := &fakeClient{err: &domain.ProviderError{Kind: domain.ErrUnavailable, Retryable: true, Err: errors.New("overloaded")}}
+	fallback := &fakeClient{}
+	r := New(cfg)
+	r.now = func() time.Time { return now }
+	r.Add("anthropic", primary, "claude")
+	r.Add("openai", fallback)
+
+	complete := func() {
+		t.Helper()
+		resp, err := r.Complete(context.Background(), chat.CompletionRequest{Model: "claude-x"})
+		if err != nil || resp.Text != "answer from gpt-x" {
+			t.Fatalf("Complete() = %q, %v; want the fallback's answer", resp.Text, err)
+		}
+	}
+
+	for range 4 {
+		complete()
+	}
+	if primary.calls != 2 || fallback.calls != 4 {
+		t.Fatalf("primary called %d times, fallback %d; want the breaker open after 2 failures", primary.calls, fallback.calls)
+	}
+
+	now = now.Add(59 * time.Second)
+	complete()
+	if primary.calls != 2 {
+		t.Fatalf("primary called %d times during the cooldown, want 2", primary.calls)
+	}
+
+	// after the cooldown a trial request goes through and closes the breaker
+	now = now.Add(2 * time.Second)
+	primary.err = nil
+	resp, err := r.Complete(context.Background(), chat.CompletionRequest{Model: "claude-x"})
+	if err != nil || resp.Text != "answer from claude-x" || primary.calls != 3 {
+		t.Fatalf("Complete() after cooldown = %q, %v with %d primary calls; want the primary's answer", resp.Text, err, primary.calls)
+	}
+}
+
+func TestBreakerDefaultsFromConfig(t *testing.T) {
+	cfg := loadConfig(t, map[string]string{
+		"BREAKER_FAILURES":     "",
+		"BREAKER_COOLDOWN_SEC": "",
+	})
+	if cfg.BreakerFailures != 3 || cfg.BreakerCooldown != 30*time.Second {
+		t.Fatalf("breaker config = %d failures, %s cooldown; want 3 and 30s", cfg.BreakerFailures, cfg.BreakerCooldown)
+	}
+
+	primary := &fakeClient{err: &domain.ProviderError{Kind: domain.ErrTimeout, Retryable: true, Err: errors.New("timeout")}}
+	r := New(cfg)
+	r.Add("openai", primary)
+
+	for range 5 {
+		if _, err := r.Complete(context.Background(), chat.CompletionRequest{Model: "gpt-x"}); err == nil {
+			t.Fatal("Complete() succeeded, want an error")
+		}
+	}
+	if primary.calls != 3 {
+		t.Fatalf("primary called %d times, want 3 before the breaker opens", primary.calls)
+	}
+}
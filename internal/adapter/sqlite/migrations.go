@@ -0,0 +1,88 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+var migrations = []string{
+	`CREATE TABLE messages (
+		id         INTEGER PRIMARY KEY AUTOINCREMENT,
+		chat_id    INTEGER NOT NULL,
+		role       TEXT    NOT NULL,
+		content    TEXT    NOT NULL,
+		created_at INTEGER NOT NULL
+	)`,
+	`CREATE INDEX idx_messages_chat_created ON messages (chat_id, created_at)`,
+	`CREATE TABLE chat_settings (
+		chat_id INTEGER PRIMARY KEY,
+		model   TEXT NOT NULL DEFAULT ''
+	)`,
+	`ALTER TABLE chat_settings ADD COLUMN persona TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE chat_settings ADD COLUMN system_prompt TEXT NOT NULL DEFAULT ''`,
+	`CREATE TABLE summaries (
+		chat_id    INTEGER PRIMARY KEY,
+		content    TEXT    NOT NULL,
+		until      INTEGER NOT NULL,
+		updated_at INTEGER NOT NULL
+	)`,
+	`CREATE TABLE usage (
+		id                INTEGER PRIMARY KEY AUTOINCREMENT,
+		created_at        INTEGER NOT NULL,
+		user_id           INTEGER NOT NULL,
+		chat_id           INTEGER NOT NULL,
+		kind              TEXT    NOT NULL,
+		model             TEXT    NOT NULL,
+		prompt_tokens     INTEGER NOT NULL DEFAULT 0,
+		completion_tokens INTEGER NOT NULL DEFAULT 0,
+		tts_chars         INTEGER NOT NULL DEFAULT 0,
+		images            INTEGER NOT NULL DEFAULT 0,
+		cost              REAL    NOT NULL DEFAULT 0
+	)`,
+	`CREATE INDEX idx_usage_user_created ON usage (user_id, created_at)`,
+	`CREATE INDEX idx_usage_chat_created ON usage (chat_id, created_at)`,
+	`CREATE INDEX idx_usage_created ON usage (created_at)`,
+	`ALTER TABLE chat_settings ADD COLUMN group_reply_mode TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE chat_settings ADD COLUMN group_context TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE messages ADD COLUMN message_id INTEGER NOT NULL DEFAULT 0`,
+	`ALTER TABLE messages ADD COLUMN parent_id INTEGER NOT NULL DEFAULT 0`,
+	`CREATE INDEX idx_messages_chat_message ON messages (chat_id, message_id)`,
+}
+
+func migrate(ctx context.Context, db *sql.DB) error {
+	if _, err := db.ExecContext(ctx,
+		`CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY)`,
+	); err != nil {
+		return fmt.Errorf("create schema_migrations: %w", err)
+	}
+
+	var current int
+	if err := db.QueryRowContext(ctx,
+		`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`,
+	).Scan(&current); err != nil {
+		return fmt.Errorf("read schema version: %w", err)
+	}
+
+	for version := current + 1; version <= len(migrations); version++ {
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, migrations[version-1]); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("migration %d: %w", version, err)
+		}
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO schema_migrations (version) VALUES (?)`, version,
+		); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("record migration %d: %w", version, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("commit migration %d: %w", version, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,45 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+
+	"chatgpt-telegram-bot/internal/domain"
+)
+
+func (s *Store) Settings(chatID int64) domain.ChatSettings {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	var settings domain.ChatSettings
+	err := s.db.QueryRowContext(ctx,
+		`SELECT model, persona, system_prompt, group_reply_mode, group_context
+		FROM chat_settings WHERE chat_id = ?`, chatID,
+	).Scan(&settings.Model, &settings.Persona, &settings.SystemPrompt, &settings.GroupReplyMode, &settings.GroupContext)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("failed to load settings for chat %d: %v", chatID, err)
+	}
+	return settings
+}
+
+func (s *Store) SaveSettings(chatID int64, settings domain.ChatSettings) {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO chat_settings (chat_id, model, persona, system_prompt, group_reply_mode, group_context)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (chat_id) DO UPDATE SET
+			model = excluded.model,
+			persona = excluded.persona,
+			system_prompt = excluded.system_prompt,
+			group_reply_mode = excluded.group_reply_mode,
+			group_context = excluded.group_context`,
+		chatID, settings.Model, settings.Persona, settings.SystemPrompt, settings.GroupReplyMode, settings.GroupContext,
+	)
+	if err != nil {
+		log.Printf("failed to save settings for chat %d: %v", chatID, err)
+	}
+}
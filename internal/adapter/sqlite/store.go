@@ -0,0 +1,266 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	_ "modernc.org/sqlite"
+
+	"chatgpt-telegram-bot/internal/domain"
+)
+
+const queryTimeout = 5 * time.Second
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(dsn string) (*Store, error) {
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	// sqlite allows a single writer; one connection avoids SQLITE_BUSY under load
+	db.SetMaxOpenConns(1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	for _, pragma := range []string{
+		`PRAGMA journal_mode = WAL`,
+		`PRAGMA busy_timeout = 5000`,
+	} {
+		if _, err := db.ExecContext(ctx, pragma); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+
+	if err := migrate(ctx, db); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &Store{db: db}, nil
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+func (s *Store) Add(chatID int64, msg domain.Message) {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO messages (chat_id, role, content, created_at, message_id, parent_id)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		chatID, msg.Role, msg.Content, msg.Timestamp.UnixNano(), msg.MessageID, msg.ParentID,
+	)
+	if err != nil {
+		log.Printf("failed to store message for chat %d: %v", chatID, err)
+	}
+}
+
+func (s *Store) FreshMessages(chatID int64, limit int, ttl time.Duration) []domain.Message {
+	if limit <= 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	cutoff := time.Now().Add(-ttl).UnixNano()
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT role, content, created_at, message_id, parent_id FROM (
+			SELECT id, role, content, created_at, message_id, parent_id FROM messages
+			WHERE chat_id = ? AND created_at > ?
+			ORDER BY created_at DESC, id DESC
+			LIMIT ?
+		) ORDER BY created_at ASC, id ASC`,
+		chatID, cutoff, limit,
+	)
+	if err != nil {
+		log.Printf("failed to load messages for chat %d: %v", chatID, err)
+		return nil
+	}
+	defer rows.Close()
+
+	return scanMessages(chatID, rows)
+}
+
+func (s *Store) List(chatID int64, limit int) []domain.Message {
+	if limit <= 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT role, content, created_at, message_id, parent_id FROM (
+			SELECT id, role, content, created_at, message_id, parent_id FROM messages
+			WHERE chat_id = ?
+			ORDER BY created_at DESC, id DESC
+			LIMIT ?
+		) ORDER BY created_at ASC, id ASC`,
+		chatID, limit,
+	)
+	if err != nil {
+		log.Printf("failed to list messages for chat %d: %v", chatID, err)
+		return nil
+	}
+	defer rows.Close()
+
+	return scanMessages(chatID, rows)
+}
+
+func (s *Store) Thread(chatID int64, messageID int, limit int, ttl time.Duration) []domain.Message {
+	if messageID == 0 || limit <= 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	cutoff := time.Now().Add(-ttl).UnixNano()
+	// depth caps the walk, also when parent links form a cycle
+	rows, err := s.db.QueryContext(ctx,
+		`WITH RECURSIVE thread (id, parent_id, depth) AS (
+			SELECT id, parent_id, 1 FROM messages
+			WHERE chat_id = ? AND message_id = ? AND created_at > ?
+			UNION ALL
+			SELECT m.id, m.parent_id, t.depth + 1 FROM messages m
+			JOIN thread t ON m.message_id = t.parent_id
+			WHERE m.chat_id = ? AND t.parent_id != 0 AND m.created_at > ? AND t.depth < ?
+		)
+		SELECT role, content, created_at, message_id, parent_id FROM messages
+		WHERE id IN (SELECT id FROM thread)
+		ORDER BY created_at ASC, id ASC`,
+		chatID, messageID, cutoff, chatID, cutoff, limit,
+	)
+	if err != nil {
+		log.Printf("failed to load thread for chat %d: %v", chatID, err)
+		return nil
+	}
+	defer rows.Close()
+
+	return scanMessages(chatID, rows)
+}
+
+func (s *Store) SetReplyID(chatID int64, parentID, messageID int) {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE messages SET message_id = ? WHERE id = (
+			SELECT id FROM messages
+			WHERE chat_id = ? AND role = ? AND parent_id = ? AND message_id = 0
+			ORDER BY created_at DESC, id DESC
+			LIMIT 1
+		)`,
+		messageID, chatID, domain.RoleAssistant, parentID,
+	)
+	if err != nil {
+		log.Printf("failed to set reply id for chat %d: %v", chatID, err)
+	}
+}
+
+func (s *Store) DeleteLast(chatID int64, n int) {
+	if n <= 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx,
+		`DELETE FROM messages WHERE id IN (
+			SELECT id FROM messages
+			WHERE chat_id = ?
+			ORDER BY created_at DESC, id DESC
+			LIMIT ?
+		)`,
+		chatID, n,
+	)
+	if err != nil {
+		log.Printf("failed to delete messages for chat %d: %v", chatID, err)
+	}
+}
+
+func (s *Store) Clear(chatID int64) {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	for _, query := range []string{
+		`DELETE FROM messages WHERE chat_id = ?`,
+		`DELETE FROM summaries WHERE chat_id = ?`,
+	} {
+		if _, err := s.db.ExecContext(ctx, query, chatID); err != nil {
+			log.Printf("failed to clear chat %d: %v", chatID, err)
+		}
+	}
+}
+
+func (s *Store) Summary(chatID int64) domain.Summary {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	var (
+		summary        domain.Summary
+		until, updated int64
+	)
+	err := s.db.QueryRowContext(ctx,
+		`SELECT content, until, updated_at FROM summaries WHERE chat_id = ?`, chatID,
+	).Scan(&summary.Content, &until, &updated)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("failed to load summary for chat %d: %v", chatID, err)
+		}
+		return domain.Summary{}
+	}
+	summary.Until = time.Unix(0, until)
+	summary.UpdatedAt = time.Unix(0, updated)
+	return summary
+}
+
+func (s *Store) SaveSummary(chatID int64, summary domain.Summary) {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO summaries (chat_id, content, until, updated_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT (chat_id) DO UPDATE SET
+			content = excluded.content,
+			until = excluded.until,
+			updated_at = excluded.updated_at`,
+		chatID, summary.Content, summary.Until.UnixNano(), summary.UpdatedAt.UnixNano(),
+	)
+	if err != nil {
+		log.Printf("failed to save summary for chat %d: %v", chatID, err)
+	}
+}
+
+func scanMessages(chatID int64, rows *sql.Rows) []domain.Message {
+	var res []domain.Message
+	for rows.Next() {
+		var (
+			m       domain.Message
+			created int64
+		)
+		if err := rows.Scan(&m.Role, &m.Content, &created, &m.MessageID, &m.ParentID); err != nil {
+			log.Printf("failed to scan message for chat %d: %v", chatID, err)
+			return nil
+		}
+		m.Timestamp = time.Unix(0, created)
+		res = append(res, m)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("failed to read messages for chat %d: %v", chatID, err)
+		return nil
+	}
+	return res
+}
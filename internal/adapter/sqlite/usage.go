@@ -0,0 +1,85 @@
+package sqlite
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"chatgpt-telegram-bot/internal/domain"
+)
+
+const usageColumns = `COUNT(*), COALESCE(SUM(prompt_tokens), 0), COALESCE(SUM(completion_tokens), 0),
+	COALESCE(SUM(tts_chars), 0), COALESCE(SUM(images), 0), COALESCE(SUM(cost), 0)`
+
+func (s *Store) Record(rec domain.UsageRecord) {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO usage (created_at, user_id, chat_id, kind, model,
+			prompt_tokens, completion_tokens, tts_chars, images, cost)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		rec.Timestamp.UnixNano(), rec.UserID, rec.ChatID, rec.Kind, rec.Model,
+		rec.PromptTokens, rec.CompletionTokens, rec.TTSChars, rec.Images, rec.Cost,
+	)
+	if err != nil {
+		log.Printf("failed to record usage for user %d: %v", rec.UserID, err)
+	}
+}
+
+func (s *Store) Totals(filter domain.UsageFilter) domain.UsageTotals {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	var totals domain.UsageTotals
+	err := s.db.QueryRowContext(ctx,
+		`SELECT `+usageColumns+` FROM usage
+		WHERE created_at >= ?
+			AND (? = 0 OR user_id = ?)
+			AND (? = 0 OR chat_id = ?)`,
+		filter.Since.UnixNano(),
+		filter.UserID, filter.UserID,
+		filter.ChatID, filter.ChatID,
+	).Scan(&totals.Requests, &totals.PromptTokens, &totals.CompletionTokens,
+		&totals.TTSChars, &totals.Images, &totals.Cost)
+	if err != nil {
+		log.Printf("failed to load usage totals: %v", err)
+		return domain.UsageTotals{}
+	}
+	return totals
+}
+
+func (s *Store) TopUsers(since time.Time, limit int) []domain.UserUsage {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT user_id, `+usageColumns+` FROM usage
+		WHERE created_at >= ?
+		GROUP BY user_id
+		ORDER BY SUM(cost) DESC, COUNT(*) DESC
+		LIMIT ?`,
+		since.UnixNano(), limit,
+	)
+	if err != nil {
+		log.Printf("failed to load top users: %v", err)
+		return nil
+	}
+	defer rows.Close()
+
+	var res []domain.UserUsage
+	for rows.Next() {
+		var u domain.UserUsage
+		if err := rows.Scan(&u.UserID, &u.Requests, &u.PromptTokens, &u.CompletionTokens,
+			&u.TTSChars, &u.Images, &u.Cost); err != nil {
+			log.Printf("failed to scan top users: %v", err)
+			return nil
+		}
+		res = append(res, u)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("failed to read top users: %v", err)
+		return nil
+	}
+	return res
+}
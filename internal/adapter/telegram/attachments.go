@@ -1,7 +1,9 @@
 package telegram
 
 import (
+	"context"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -9,39 +11,43 @@ import (
 	"net/http"
 	"path/filepath"
 	"strings"
+	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 
+	"chatgpt-telegram-bot/internal/extract"
 	"chatgpt-telegram-bot/internal/usecase/chat"
 )
 
-func DescribeAttachments(bot *tgbotapi.BotAPI, msg *tgbotapi.Message) ([]string, []chat.Image) {
+var errFileTooLarge = errors.New("file too large")
+
+func (b *Bot) DescribeAttachments(ctx context.Context, msg *tgbotapi.Message) ([]string, []chat.Image) {
 	parts := make([]string, 0, 8)
 	images := make([]chat.Image, 0, 4)
 
 	if msg.Document != nil {
-		part, img := describeDocument(bot, msg.Document)
+		part, img := b.describeDocument(msg.Document)
 		parts = append(parts, part)
 		if img.DataURL != "" {
 			images = append(images, img)
 		}
 	}
 	if len(msg.Photo) > 0 {
-		part, imgs := describePhoto(bot, msg.Photo)
+		part, imgs := b.describePhoto(msg.Photo)
 		parts = append(parts, part)
 		images = append(images, imgs...)
 	}
 	if msg.Audio != nil {
-		parts = append(parts, describeAudio(bot, msg.Audio))
+		parts = append(parts, b.describeAudio(ctx, msg.Audio))
 	}
 	if msg.Voice != nil {
-		parts = append(parts, describeVoice(bot, msg.Voice))
+		parts = append(parts, b.describeVoice(ctx, msg.Voice))
 	}
 	if msg.Video != nil {
-		parts = append(parts, describeVideo(bot, msg.Video))
+		parts = append(parts, describeVideo(b.api, msg.Video))
 	}
 	if msg.VideoNote != nil {
-		parts = append(parts, describeVideoNote(bot, msg.VideoNote))
+		parts = append(parts, describeVideoNote(b.api, msg.VideoNote))
 	}
 	if msg.Sticker != nil {
 		parts = append(parts, fmt.Sprintf(
@@ -50,7 +56,7 @@ func DescribeAttachments(bot *tgbotapi.BotAPI, msg *tgbotapi.Message) ([]string,
 		))
 	}
 	if msg.Animation != nil {
-		part, img := describeAnimation(bot, msg.Animation)
+		part, img := b.describeAnimation(msg.Animation)
 		parts = append(parts, part)
 		if img.DataURL != "" {
 			images = append(images, img)
@@ -60,29 +66,84 @@ func DescribeAttachments(bot *tgbotapi.BotAPI, msg *tgbotapi.Message) ([]string,
 	return parts, images
 }
 
-func describeDocument(bot *tgbotapi.BotAPI, doc *tgbotapi.Document) (string, chat.Image) {
+func (b *Bot) describeDocument(doc *tgbotapi.Document) (string, chat.Image) {
 	part := fmt.Sprintf(
 		"Document: %s (%d bytes, mime %s).",
 		doc.FileName, doc.FileSize, doc.MimeType,
 	)
 	if strings.HasPrefix(doc.MimeType, "image/") {
-		dataURL, err := fetchDataURL(bot, doc.FileID, doc.MimeType)
+		dataURL, err := b.fetchDataURL(doc.FileID, doc.MimeType)
 		if err != nil {
 			log.Printf("could not fetch image document: %v", err)
 			return part, chat.Image{}
 		}
 		return part, chat.Image{DataURL: dataURL}
 	}
-	return part, chat.Image{}
+	return b.extractDocument(part, doc), chat.Image{}
 }
 
-func describePhoto(bot *tgbotapi.BotAPI, photos []tgbotapi.PhotoSize) (string, []chat.Image) {
+// extractDocument appends the text content of doc to part when its type is
+// supported and it fits the configured size limit.
+func (b *Bot) extractDocument(part string, doc *tgbotapi.Document) string {
+	if _, ok := extract.Detect(doc.FileName, doc.MimeType); !ok {
+		return part
+	}
+	limit := b.cfg.DocumentMaxBytes
+	if limit <= 0 || (b.cfg.DownloadMaxBytes > 0 && b.cfg.DownloadMaxBytes < limit) {
+		limit = b.cfg.DownloadMaxBytes
+	}
+	// FileSize is optional, so the download enforces the limit as well
+	if limit > 0 && int64(doc.FileSize) > limit {
+		return part + fmt.Sprintf(" Too large to read (limit %d bytes).", limit)
+	}
+
+	data, _, _, err := b.downloadFile(doc.FileID, limit)
+	if errors.Is(err, errFileTooLarge) {
+		return part + fmt.Sprintf(" Too large to read (limit %d bytes).", limit)
+	}
+	if err != nil {
+		log.Printf("could not fetch document: %v", err)
+		return part
+	}
+
+	res, err := extract.Text(doc.FileName, doc.MimeType, data, b.cfg.DocumentMaxChars)
+	if err != nil {
+		log.Printf("could not extract document %q: %v", doc.FileName, err)
+		return part + " Could not read its content."
+	}
+
+	var sb strings.Builder
+	sb.WriteString(part)
+	fence := codeFence(res.Text)
+	fmt.Fprintf(&sb, "\nContent of %s:\n%s\n%s\n%s", doc.FileName, fence, res.Text, fence)
+	if res.Truncated {
+		fmt.Fprintf(&sb, "\n[Document truncated to the first %d characters.]", b.cfg.DocumentMaxChars)
+	}
+	return sb.String()
+}
+
+// codeFence returns a backtick fence longer than any backtick run in text, so
+// text cannot close the block early.
+func codeFence(text string) string {
+	longest, run := 0, 0
+	for _, r := range text {
+		if r == '`' {
+			run++
+			longest = max(longest, run)
+		} else {
+			run = 0
+		}
+	}
+	return strings.Repeat("`", max(3, longest+1))
+}
+
+func (b *Bot) describePhoto(photos []tgbotapi.PhotoSize) (string, []chat.Image) {
 	best := photos[len(photos)-1]
 	part := fmt.Sprintf(
 		"Photo: resolution %dx%d (%d bytes).",
 		best.Width, best.Height, best.FileSize,
 	)
-	dataURL, err := fetchDataURL(bot, best.FileID, "image/jpeg")
+	dataURL, err := b.fetchDataURL(best.FileID, "image/jpeg")
 	if err != nil {
 		log.Printf("could not fetch photo: %v", err)
 		return part, nil
@@ -90,18 +151,52 @@ func describePhoto(bot *tgbotapi.BotAPI, photos []tgbotapi.PhotoSize) (string, [
 	return part, []chat.Image{{DataURL: dataURL}}
 }
 
-func describeAudio(bot *tgbotapi.BotAPI, audio *tgbotapi.Audio) string {
-	return fmt.Sprintf(
+func (b *Bot) describeAudio(ctx context.Context, audio *tgbotapi.Audio) string {
+	meta := fmt.Sprintf(
 		"Audio: %s (%d sec, %d bytes, mime %s).",
 		audio.Title, audio.Duration, audio.FileSize, audio.MimeType,
 	)
+	return b.transcribeOr(ctx, meta, audio.FileID, audio.FileName, audio.Duration)
 }
 
-func describeVoice(bot *tgbotapi.BotAPI, voice *tgbotapi.Voice) string {
-	return fmt.Sprintf(
+func (b *Bot) describeVoice(ctx context.Context, voice *tgbotapi.Voice) string {
+	meta := fmt.Sprintf(
 		"Voice message: duration %d sec (%d bytes, mime %s).",
 		voice.Duration, voice.FileSize, voice.MimeType,
 	)
+	return b.transcribeOr(ctx, meta, voice.FileID, "voice.ogg", voice.Duration)
+}
+
+// transcribeOr returns the transcript of an audio file, or meta when the file
+// cannot be transcribed.
+func (b *Bot) transcribeOr(ctx context.Context, meta, fileID, name string, durationSec int) string {
+	if b.stt == nil {
+		return meta
+	}
+
+	duration := time.Duration(durationSec) * time.Second
+	if !b.stt.Allowed(duration) {
+		return meta + " Too long to transcribe."
+	}
+
+	data, filePath, _, err := b.downloadFile(fileID, b.cfg.DownloadMaxBytes)
+	if err != nil {
+		log.Printf("could not fetch audio: %v", err)
+		return meta
+	}
+	if name == "" {
+		name = filepath.Base(filePath)
+	}
+
+	text, err := b.stt.Transcribe(ctx, name, data, duration)
+	if err != nil {
+		log.Printf("transcription failed: %v", err)
+		return meta
+	}
+	if strings.TrimSpace(text) == "" {
+		return meta + " No speech recognized."
+	}
+	return text
 }
 
 func describeVideo(bot *tgbotapi.BotAPI, video *tgbotapi.Video) string {
@@ -119,7 +214,7 @@ func describeVideoNote(bot *tgbotapi.BotAPI, note *tgbotapi.VideoNote) string {
 	)
 }
 
-func describeAnimation(bot *tgbotapi.BotAPI, animation *tgbotapi.Animation) (string, chat.Image) {
+func (b *Bot) describeAnimation(animation *tgbotapi.Animation) (string, chat.Image) {
 	name := animation.FileName
 	if name == "" {
 		name = filepath.Base(animation.FileID)
@@ -129,7 +224,7 @@ func describeAnimation(bot *tgbotapi.BotAPI, animation *tgbotapi.Animation) (str
 		name, animation.FileSize, animation.MimeType,
 	)
 	if strings.HasPrefix(animation.MimeType, "image/") {
-		dataURL, err := fetchDataURL(bot, animation.FileID, animation.MimeType)
+		dataURL, err := b.fetchDataURL(animation.FileID, animation.MimeType)
 		if err != nil {
 			log.Printf("could not fetch animation image: %v", err)
 			return part, chat.Image{}
@@ -139,31 +234,54 @@ func describeAnimation(bot *tgbotapi.BotAPI, animation *tgbotapi.Animation) (str
 	return part, chat.Image{}
 }
 
-func fetchDataURL(bot *tgbotapi.BotAPI, fileID, fallbackMime string) (string, error) {
-	file, err := bot.GetFile(tgbotapi.FileConfig{FileID: fileID})
+// downloadFile fetches a file of at most maxBytes; 0 means no limit.
+func (b *Bot) downloadFile(fileID string, maxBytes int64) ([]byte, string, string, error) {
+	file, err := b.api.GetFile(tgbotapi.FileConfig{FileID: fileID})
 	if err != nil {
-		return "", err
+		return nil, "", "", err
+	}
+	if maxBytes > 0 && int64(file.FileSize) > maxBytes {
+		return nil, "", "", fmt.Errorf("%w: %d bytes, limit %d", errFileTooLarge, file.FileSize, maxBytes)
 	}
-	url := fmt.Sprintf("https://api.telegram.org/file/bot%s/%s", bot.Token, file.FilePath)
+	url := fmt.Sprintf("https://api.telegram.org/file/bot%s/%s", b.api.Token, file.FilePath)
 
 	resp, err := http.Get(url) // #nosec G107
 	if err != nil {
-		return "", err
+		return nil, "", "", err
 	}
 	defer resp.Body.Close()
 
-	data, err := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", "", fmt.Errorf("download failed: status %d", resp.StatusCode)
+	}
+
+	body := io.Reader(resp.Body)
+	if maxBytes > 0 {
+		body = io.LimitReader(resp.Body, maxBytes+1)
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, "", "", err
+	}
+	if maxBytes > 0 && int64(len(data)) > maxBytes {
+		return nil, "", "", fmt.Errorf("%w: over %d bytes", errFileTooLarge, maxBytes)
+	}
+
+	return data, file.FilePath, resp.Header.Get("Content-Type"), nil
+}
+
+func (b *Bot) fetchDataURL(fileID, fallbackMime string) (string, error) {
+	data, filePath, mimeType, err := b.downloadFile(fileID, b.cfg.DownloadMaxBytes)
 	if err != nil {
 		return "", err
 	}
 
-	mimeType := resp.Header.Get("Content-Type")
 	// prefer declared image mime; otherwise try fallback and extension
 	if !strings.HasPrefix(strings.ToLower(mimeType), "image/") {
 		if strings.HasPrefix(strings.ToLower(fallbackMime), "image/") {
 			mimeType = fallbackMime
 		} else {
-			extMime := mime.TypeByExtension(filepath.Ext(file.FilePath))
+			extMime := mime.TypeByExtension(filepath.Ext(filePath))
 			if strings.HasPrefix(strings.ToLower(extMime), "image/") {
 				mimeType = extMime
 			}
@@ -173,7 +291,7 @@ func fetchDataURL(bot *tgbotapi.BotAPI, fileID, fallbackMime string) (string, er
 		mimeType = fallbackMime
 	}
 	if mimeType == "" {
-		mimeType = mime.TypeByExtension(filepath.Ext(file.FilePath))
+		mimeType = mime.TypeByExtension(filepath.Ext(filePath))
 	}
 	if mimeType == "" {
 		return "", fmt.Errorf("non-image mime: unknown")
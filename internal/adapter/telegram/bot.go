@@ -1,68 +1,147 @@
 package telegram
 
 import (
+	"cmp"
 	"context"
 	"errors"
+	"fmt"
 	"log"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 
 	"chatgpt-telegram-bot/internal/config"
+	"chatgpt-telegram-bot/internal/domain"
 	"chatgpt-telegram-bot/internal/usecase/chat"
 	imagegen "chatgpt-telegram-bot/internal/usecase/image"
+	"chatgpt-telegram-bot/internal/usecase/quota"
+	"chatgpt-telegram-bot/internal/usecase/transcribe"
 	"chatgpt-telegram-bot/internal/usecase/tts"
+	"chatgpt-telegram-bot/internal/usecase/usage"
 )
 
 type Bot struct {
-	api  *tgbotapi.BotAPI
-	cfg  config.Config
-	chat *chat.Service
-	tts  *tts.Service
-	img  *imagegen.Service
-	now  func() time.Time
+	api   *tgbotapi.BotAPI
+	cfg   config.Config
+	chat  *chat.Service
+	tts   *tts.Service
+	img   *imagegen.Service
+	stt   *transcribe.Service
+	usage *usage.Service
+	quota *quota.Service
+	now   func() time.Time
+
+	dispatcher *dispatcher
+	replies    replyLog
+	streams    streamRegistry
 }
 
-func NewBot(cfg config.Config, chatSvc *chat.Service, ttsSvc *tts.Service, imgSvc *imagegen.Service) (*Bot, error) {
+func NewBot(cfg config.Config, chatSvc *chat.Service, ttsSvc *tts.Service, imgSvc *imagegen.Service, sttSvc *transcribe.Service, usageSvc *usage.Service, quotaSvc *quota.Service) (*Bot, error) {
 	api, err := tgbotapi.NewBotAPI(cfg.TelegramToken)
 	if err != nil {
 		return nil, err
 	}
 
 	return &Bot{
-		api:  api,
-		cfg:  cfg,
-		chat: chatSvc,
-		tts:  ttsSvc,
-		img:  imgSvc,
-		now:  time.Now,
+		api:   api,
+		cfg:   cfg,
+		chat:  chatSvc,
+		tts:   ttsSvc,
+		img:   imgSvc,
+		stt:   sttSvc,
+		usage: usageSvc,
+		quota: quotaSvc,
+		now:   time.Now,
+
+		dispatcher: newDispatcher(cfg.Workers, cfg.WorkerQueueSize),
 	}, nil
 }
 
 func (b *Bot) Run(ctx context.Context) error {
+	// handlers outlive ctx so in-flight replies can finish during shutdown
+	workCtx, cancelWork := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelWork()
+	defer b.drain(cancelWork)
+
+	if b.cfg.TelegramMode == "webhook" {
+		return b.runWebhook(ctx, workCtx)
+	}
+	return b.runPolling(ctx, workCtx)
+}
+
+func (b *Bot) runPolling(ctx, workCtx context.Context) error {
+	if _, err := b.api.Request(tgbotapi.DeleteWebhookConfig{}); err != nil {
+		return err
+	}
+
 	u := tgbotapi.NewUpdate(0)
 	u.Timeout = 60
 
 	updates := b.api.GetUpdatesChan(u)
+	defer b.api.StopReceivingUpdates()
 
 	for {
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
 		case update := <-updates:
-			if update.Message == nil {
-				continue
+			if err := b.dispatch(ctx, workCtx, update); err != nil {
+				return err
 			}
-			msg := update.Message
-			if msg.From == nil {
-				continue
-			}
-			go b.handleMessage(ctx, msg)
 		}
 	}
 }
 
+// dispatch queues update for processing on workCtx, blocking on ctx while
+// the dispatcher queue is full.
+func (b *Bot) dispatch(ctx, workCtx context.Context, update tgbotapi.Update) error {
+	if query := update.CallbackQuery; query != nil {
+		if query.Data == callbackStop {
+			b.handleStop(query)
+			return nil
+		}
+		chatID := query.From.ID
+		if query.Message != nil {
+			chatID = query.Message.Chat.ID
+		}
+		return b.dispatcher.Submit(ctx, chatID, func() {
+			b.handleCallback(workCtx, query)
+		})
+	}
+	if update.Message == nil {
+		return nil
+	}
+	if update.Message.From == nil {
+		return nil
+	}
+	msg, ok := b.addressed(update.Message)
+	if !ok {
+		return nil
+	}
+	return b.dispatcher.Submit(ctx, msg.Chat.ID, func() {
+		b.handleMessage(workCtx, msg)
+	})
+}
+
+// drain waits for running handlers up to the shutdown timeout, then cancels them.
+func (b *Bot) drain(cancel context.CancelFunc) {
+	done := make(chan struct{})
+	go func() {
+		b.dispatcher.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(b.cfg.ShutdownTimeout):
+		log.Printf("shutdown timeout reached, cancelling running handlers")
+		cancel()
+		<-done
+	}
+}
+
 func (b *Bot) handleMessage(ctx context.Context, msg *tgbotapi.Message) {
 	if !isAllowedUser(msg.From.ID, msg.Chat.ID, b.cfg) {
 		deny := tgbotapi.NewMessage(msg.Chat.ID, "access denied")
@@ -73,104 +152,222 @@ func (b *Bot) handleMessage(ctx context.Context, msg *tgbotapi.Message) {
 		return
 	}
 
-	if ok, text := extractCommandText(msg.Text, "tts"); ok {
-		if strings.TrimSpace(text) == "" {
-			b.sendText(msg.Chat.ID, msg.MessageID, "usage: /tts <text>")
-			return
-		}
+	if ok, _ := extractCommandText(msg.Text, "reset"); ok {
+		b.handleReset(msg)
+		return
+	}
 
-		b.sendVoiceAction(msg.Chat.ID)
-		audio, err := b.tts.Synthesize(ctx, text)
-		if err != nil {
-			if errors.Is(err, tts.ErrEmptyText) {
-				b.sendText(msg.Chat.ID, msg.MessageID, "i need some text to synthesize")
-				return
-			}
-			log.Printf("tts request failed: %v", err)
-			b.sendText(msg.Chat.ID, msg.MessageID, "failed to generate audio, try again later")
-			return
-		}
+	if ok, arg := extractCommandText(msg.Text, "history"); ok {
+		b.handleHistory(msg, arg)
+		return
+	}
 
-		if err := b.sendVoice(msg.Chat.ID, msg.MessageID, audio); err != nil {
-			log.Printf("failed to send voice: %v", err)
-			b.sendText(msg.Chat.ID, msg.MessageID, "could not send voice message")
-		}
+	if ok, _ := extractCommandText(msg.Text, "context"); ok {
+		b.handleContext(ctx, msg)
+		return
+	}
+
+	if ok, arg := extractCommandText(msg.Text, "model"); ok {
+		b.handleModel(msg, arg)
+		return
+	}
+
+	if ok, arg := extractCommandText(msg.Text, "system"); ok {
+		b.handleSystem(msg, arg)
+		return
+	}
+
+	if ok, arg := extractCommandText(msg.Text, "persona"); ok {
+		b.handlePersona(msg, arg)
+		return
+	}
+
+	if ok, arg := extractCommandText(msg.Text, "group"); ok {
+		b.handleGroup(msg, arg)
 		return
 	}
 
-	if ok, text := extractCommandText(msg.Text, "img"); ok {
+	if ok, _ := extractCommandText(msg.Text, "usage"); ok {
+		b.handleUsage(msg)
+		return
+	}
+
+	if ok, _ := extractCommandText(msg.Text, "stats"); ok {
+		b.handleStats(msg)
+		return
+	}
+
+	if ok, text := extractCommandText(msg.Text, "tts"); ok {
 		if strings.TrimSpace(text) == "" {
-			b.sendText(msg.Chat.ID, msg.MessageID, "usage: /img <prompt>")
+			b.sendText(msg.Chat.ID, msg.MessageID, "usage: /tts <text>")
 			return
 		}
+		b.speak(ctx, msg, text)
+		return
+	}
 
-		b.sendPhotoAction(msg.Chat.ID)
-		imageResp, err := b.img.Generate(ctx, text)
-		if err != nil {
-			if errors.Is(err, imagegen.ErrEmptyPrompt) {
-				b.sendText(msg.Chat.ID, msg.MessageID, "i need a prompt to generate an image")
-				return
-			}
-			log.Printf("image generation failed: %v", err)
-			b.sendText(msg.Chat.ID, msg.MessageID, "failed to generate image, try again later")
-			return
-		}
+	// a photo sent with /img in its caption is edited
+	if ok, text := extractCommandText(cmp.Or(msg.Text, msg.Caption), "img"); ok {
+		b.handleImage(ctx, msg, text)
+		return
+	}
 
-		if err := b.sendImage(msg.Chat.ID, msg.MessageID, imageResp); err != nil {
-			log.Printf("failed to send image: %v", err)
-			b.sendText(msg.Chat.ID, msg.MessageID, "could not send image")
-		}
+	if !b.allow(msg, quota.Request{}) {
 		return
 	}
 
-	userInput, respondAsFile := BuildUserInput(b.api, msg)
+	userInput, respondAsFile := b.BuildUserInput(ctx, msg)
+	userInput.MessageID = msg.MessageID
+	if b.repliesToBot(msg) {
+		userInput.ReplyTo = msg.ReplyToMessage.MessageID
+	}
+	conv := b.conversation(msg)
 	b.sendChatAction(msg.Chat.ID, respondAsFile)
+	b.respond(ctx, msg, conv, respondAsFile, func(ctx context.Context, onDelta func(string) error) (chat.Reply, error) {
+		if onDelta == nil {
+			return b.chat.HandleMessage(ctx, conv, userInput)
+		}
+		return b.chat.HandleMessageStream(ctx, conv, userInput, onDelta)
+	})
+}
 
-	resp, err := b.chat.HandleMessage(ctx, msg.Chat.ID, userInput)
+// speak reads text aloud in reply to msg.
+func (b *Bot) speak(ctx context.Context, msg *tgbotapi.Message, text string) {
+	if !b.allow(msg, quota.Request{TTSChars: utf8.RuneCountInString(text)}) {
+		return
+	}
+
+	b.sendVoiceAction(msg.Chat.ID)
+	audio, err := b.tts.Synthesize(ctx, text)
 	if err != nil {
-		if errors.Is(err, chat.ErrEmptyMessage) {
-			b.sendText(msg.Chat.ID, msg.MessageID, "i need some content to work with")
+		if errors.Is(err, tts.ErrEmptyText) {
+			b.sendText(msg.Chat.ID, msg.MessageID, "i need some text to synthesize")
 			return
 		}
-		log.Printf("openai request failed: %v", err)
-		b.sendText(msg.Chat.ID, msg.MessageID, "failed to reach openai, try again later")
+		log.Printf("tts request failed: %v", err)
+		b.sendText(msg.Chat.ID, msg.MessageID, providerErrorText(err, "failed to generate audio, try again later"))
 		return
 	}
+	b.usage.RecordTTS(msg.From.ID, msg.Chat.ID, b.cfg.TTSModel, utf8.RuneCountInString(text))
 
-	if respondAsFile {
-		if err := b.sendAsFile(msg.Chat.ID, msg.MessageID, resp); err != nil {
-			log.Printf("failed to send file: %v", err)
-			b.sendText(msg.Chat.ID, msg.MessageID, "could not send file, here is the text")
-			b.sendText(msg.Chat.ID, msg.MessageID, resp)
-		}
-		return
+	if err := b.sendVoice(msg.Chat.ID, msg.MessageID, audio); err != nil {
+		log.Printf("failed to send voice: %v", err)
+		b.sendText(msg.Chat.ID, msg.MessageID, "could not send voice message")
 	}
+}
 
-	if shouldSendAsFile(resp) {
-		if err := b.sendAsFile(msg.Chat.ID, msg.MessageID, resp); err != nil {
-			log.Printf("failed to send file: %v", err)
-			b.sendText(msg.Chat.ID, msg.MessageID, "could not send file, here is the text")
-			b.sendText(msg.Chat.ID, msg.MessageID, resp)
-		}
-		return
+func (b *Bot) recordChatUsage(msg *tgbotapi.Message, reply chat.Reply) {
+	for _, u := range reply.Usage {
+		b.usage.RecordChat(msg.From.ID, msg.Chat.ID, u.Model, u.PromptTokens, u.CompletionTokens)
+	}
+}
+
+func (b *Bot) sendChatError(msg *tgbotapi.Message, err error) {
+	b.sendText(msg.Chat.ID, msg.MessageID, chatErrorText(err))
+}
+
+func chatErrorText(err error) string {
+	switch {
+	case errors.Is(err, chat.ErrEmptyMessage):
+		return "i need some content to work with"
+	case errors.Is(err, chat.ErrContextTooLong):
+		return "this message is too long for the model's context window, try a shorter one"
+	case errors.Is(err, chat.ErrNoUserTurn):
+		return "there is no message to answer again"
+	case errors.Is(err, chat.ErrImageTurn):
+		return "a message with images cannot be answered again, send the images again instead"
+	default:
+		log.Printf("openai request failed: %v", err)
+		return providerErrorText(err, "failed to reach openai, try again later")
 	}
+}
 
-	b.sendText(msg.Chat.ID, msg.MessageID, resp)
+// providerErrorText explains a classified provider failure, or returns
+// fallback when the error is not one the user can act on.
+func providerErrorText(err error, fallback string) string {
+	switch {
+	case errors.Is(err, domain.ErrRateLimited):
+		return "the model provider is rate limiting the bot right now, try again in a minute"
+	case errors.Is(err, domain.ErrContentPolicy):
+		return "the model provider refused this request because of its content policy"
+	case errors.Is(err, domain.ErrUnauthorized):
+		return "the model provider rejected the bot's credentials, please tell the bot admin"
+	case errors.Is(err, domain.ErrTimeout):
+		return "the model provider took too long to answer, try again later"
+	case errors.Is(err, domain.ErrUnavailable):
+		return "the model provider is temporarily unavailable, try again later"
+	default:
+		return fallback
+	}
+}
+
+func (b *Bot) sendTrimNotice(msg *tgbotapi.Message, reply chat.Reply) {
+	if reply.Trimmed == 0 {
+		return
+	}
+	b.sendText(msg.Chat.ID, msg.MessageID, fmt.Sprintf(
+		"note: %d older messages were left out to fit the model's context window", reply.Trimmed,
+	))
 }
 
 func (b *Bot) sendText(chatID int64, replyTo int, text string) {
-	const chunkSize = 2048
+	b.sendTextMarkup(chatID, replyTo, text, nil)
+}
 
-	chunks := splitText(text, chunkSize)
+// sendTextMarkup sends Markdown text in formatted chunks with markup on the
+// last one and returns the ID of the last message sent.
+func (b *Bot) sendTextMarkup(chatID int64, replyTo int, text string, markup *tgbotapi.InlineKeyboardMarkup) int {
+	var lastID int
+	chunks := splitMarkdown(text, messageLimit)
 	for idx, chunk := range chunks {
 		msg := tgbotapi.NewMessage(chatID, chunk)
 		if idx == 0 {
 			msg.ReplyToMessageID = replyTo
 		}
-		if _, err := b.api.Send(msg); err != nil {
+		if idx == len(chunks)-1 && markup != nil {
+			msg.ReplyMarkup = markup
+		}
+		sent, err := b.sendFormatted(msg)
+		if err != nil {
 			log.Printf("failed to send reply: %v", err)
+			continue
 		}
+		lastID = sent.MessageID
+	}
+	return lastID
+}
+
+// sendFormatted sends msg with its Markdown rendered as HTML, or as plain
+// text when Telegram rejects the markup.
+func (b *Bot) sendFormatted(msg tgbotapi.MessageConfig) (tgbotapi.Message, error) {
+	plain := msg.Text
+	msg.Text, msg.ParseMode = renderHTML(plain), tgbotapi.ModeHTML
+	sent, err := b.api.Send(msg)
+	if !isEntityError(err) {
+		return sent, err
 	}
+	log.Printf("formatting rejected, sending plain text: %v", err)
+	msg.Text, msg.ParseMode = plain, ""
+	return b.api.Send(msg)
+}
+
+// editFormatted is sendFormatted for message edits.
+func (b *Bot) editFormatted(edit tgbotapi.EditMessageTextConfig) error {
+	plain := edit.Text
+	edit.Text, edit.ParseMode = renderHTML(plain), tgbotapi.ModeHTML
+	_, err := b.api.Send(edit)
+	if !isEntityError(err) {
+		return err
+	}
+	log.Printf("formatting rejected, sending plain text: %v", err)
+	edit.Text, edit.ParseMode = plain, ""
+	_, err = b.api.Send(edit)
+	return err
+}
+
+func isEntityError(err error) bool {
+	var tgErr *tgbotapi.Error
+	return errors.As(err, &tgErr) && strings.Contains(tgErr.Message, "can't parse entities")
 }
 
 func (b *Bot) sendChatAction(chatID int64, asFile bool) {
@@ -195,16 +392,19 @@ func (b *Bot) sendPhotoAction(chatID int64) {
 	}
 }
 
-func (b *Bot) sendAsFile(chatID int64, replyTo int, content string) error {
+func (b *Bot) sendAsFile(chatID int64, replyTo int, content string, markup *tgbotapi.InlineKeyboardMarkup) (int, error) {
 	data := []byte(content)
 	doc := tgbotapi.NewDocument(chatID, tgbotapi.FileBytes{
 		Name:  "response.md",
 		Bytes: data,
 	})
 	doc.ReplyToMessageID = replyTo
+	if markup != nil {
+		doc.ReplyMarkup = markup
+	}
 
-	_, err := b.api.Send(doc)
-	return err
+	sent, err := b.api.Send(doc)
+	return sent.MessageID, err
 }
 
 func (b *Bot) sendVoice(chatID int64, replyTo int, resp tts.Response) error {
@@ -243,9 +443,10 @@ func (b *Bot) sendImage(chatID int64, replyTo int, resp imagegen.Response) error
 	return err
 }
 
-func shouldSendAsFile(text string) bool {
-	const chunkSize = 2048
-	return len([]rune(text)) > chunkSize
+// shouldSendAsFile reports whether a reply is too long to be worth reading
+// as messages.
+func (b *Bot) shouldSendAsFile(text string) bool {
+	return b.cfg.ReplyFileThreshold > 0 && utf8.RuneCountInString(text) > b.cfg.ReplyFileThreshold
 }
 
 func extractCommandText(text string, command string) (bool, string) {
@@ -268,12 +469,19 @@ func extractCommandText(text string, command string) (bool, string) {
 	return true, strings.TrimSpace(text[len(parts[0]):])
 }
 
-func isAllowedUser(userID int64, chatID int64, cfg config.Config) bool {
+func isAdmin(userID int64, cfg config.Config) bool {
 	for _, id := range cfg.AdminUserIDs {
 		if id == userID {
 			return true
 		}
 	}
+	return false
+}
+
+func isAllowedUser(userID int64, chatID int64, cfg config.Config) bool {
+	if isAdmin(userID, cfg) {
+		return true
+	}
 
 	if len(cfg.AllowedUserIDs) == 0 && len(cfg.AllowedChatIDs) == 0 {
 		return true
@@ -294,7 +502,7 @@ func isAllowedUser(userID int64, chatID int64, cfg config.Config) bool {
 	return false
 }
 
-func BuildUserInput(bot *tgbotapi.BotAPI, msg *tgbotapi.Message) (chat.Input, bool) {
+func (b *Bot) BuildUserInput(ctx context.Context, msg *tgbotapi.Message) (chat.Input, bool) {
 	respondAsFile := false
 	text := msg.Text
 	if strings.HasPrefix(strings.ToLower(text), "/file") {
@@ -310,7 +518,7 @@ func BuildUserInput(bot *tgbotapi.BotAPI, msg *tgbotapi.Message) (chat.Input, bo
 		parts = append(parts, "Caption: "+msg.Caption)
 	}
 
-	attachmentParts, images := DescribeAttachments(bot, msg)
+	attachmentParts, images := b.DescribeAttachments(ctx, msg)
 	parts = append(parts, attachmentParts...)
 
 	return chat.Input{
@@ -318,25 +526,3 @@ func BuildUserInput(bot *tgbotapi.BotAPI, msg *tgbotapi.Message) (chat.Input, bo
 		Images: images,
 	}, respondAsFile
 }
-
-func splitText(text string, chunkSize int) []string {
-	if chunkSize <= 0 {
-		return []string{text}
-	}
-
-	runes := []rune(text)
-	if len(runes) <= chunkSize {
-		return []string{text}
-	}
-
-	chunks := make([]string, 0, len(runes)/chunkSize+1)
-	for start := 0; start < len(runes); start += chunkSize {
-		end := start + chunkSize
-		if end > len(runes) {
-			end = len(runes)
-		}
-		chunks = append(chunks, string(runes[start:end]))
-	}
-
-	return chunks
-}
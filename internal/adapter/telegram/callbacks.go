@@ -0,0 +1,41 @@
+package telegram
+
+import (
+	"context"
+	"log"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const callbackModelPrefix = "model:"
+
+func (b *Bot) handleCallback(ctx context.Context, query *tgbotapi.CallbackQuery) {
+	if query.Message == nil || query.From == nil {
+		b.answerCallback(query.ID, "")
+		return
+	}
+	if !isAllowedUser(query.From.ID, query.Message.Chat.ID, b.cfg) {
+		b.answerCallback(query.ID, "access denied")
+		return
+	}
+
+	switch {
+	case strings.HasPrefix(query.Data, callbackModelPrefix):
+		b.handleModelCallback(query, strings.TrimPrefix(query.Data, callbackModelPrefix))
+	case query.Data == callbackRegenerate:
+		b.handleRegenerate(ctx, query)
+	case query.Data == callbackContinue:
+		b.handleContinue(ctx, query)
+	case query.Data == callbackReadAloud:
+		b.handleReadAloud(ctx, query)
+	default:
+		b.answerCallback(query.ID, "")
+	}
+}
+
+func (b *Bot) answerCallback(id, text string) {
+	if _, err := b.api.Request(tgbotapi.NewCallback(id, text)); err != nil {
+		log.Printf("failed to answer callback: %v", err)
+	}
+}
@@ -0,0 +1,170 @@
+package telegram
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	defaultHistoryTurns = 10
+	maxHistoryTurns     = 50
+	historyPreviewRunes = 300
+)
+
+func (b *Bot) handleReset(msg *tgbotapi.Message) {
+	b.chat.Reset(b.conversation(msg))
+	b.sendText(msg.Chat.ID, msg.MessageID, "context cleared")
+}
+
+func (b *Bot) handleHistory(msg *tgbotapi.Message, arg string) {
+	limit := defaultHistoryTurns
+	if arg != "" {
+		n, err := strconv.Atoi(arg)
+		if err != nil || n <= 0 {
+			b.sendText(msg.Chat.ID, msg.MessageID, "usage: /history [count]")
+			return
+		}
+		limit = min(n, maxHistoryTurns)
+	}
+
+	history := b.chat.History(b.conversation(msg), limit)
+	if len(history) == 0 {
+		b.sendText(msg.Chat.ID, msg.MessageID, "history is empty")
+		return
+	}
+
+	var sb strings.Builder
+	for idx, m := range history {
+		if idx > 0 {
+			sb.WriteString("\n\n")
+		}
+		fmt.Fprintf(&sb, "[%s] %s: %s",
+			m.Timestamp.Format("2006-01-02 15:04"), m.Role, truncateRunes(m.Content, historyPreviewRunes))
+	}
+	b.sendText(msg.Chat.ID, msg.MessageID, sb.String())
+}
+
+func (b *Bot) handleContext(ctx context.Context, msg *tgbotapi.Message) {
+	stats := b.chat.Context(ctx, b.conversation(msg))
+	text := fmt.Sprintf(
+		"messages in context: %d (limit %d, ttl %s)\ntokens incl. system prompt: %d of %d",
+		stats.Messages, b.cfg.ContextLimit, b.cfg.ContextTTL, stats.Tokens, stats.Budget,
+	)
+	if stats.Summarized {
+		text += "\nearlier turns are included as a summary"
+	}
+	if stats.Trimmed > 0 {
+		text += fmt.Sprintf("\n%d older messages no longer fit and will be left out", stats.Trimmed)
+	}
+	b.sendText(msg.Chat.ID, msg.MessageID, text)
+}
+
+func truncateRunes(text string, limit int) string {
+	runes := []rune(text)
+	if len(runes) <= limit {
+		return text
+	}
+	return string(runes[:limit]) + "…"
+}
+
+func (b *Bot) handleModel(msg *tgbotapi.Message, arg string) {
+	if arg != "" {
+		if err := b.chat.SetModel(msg.Chat.ID, arg); err != nil {
+			b.sendText(msg.Chat.ID, msg.MessageID,
+				"unknown model, available: "+strings.Join(b.chat.Models(), ", "))
+			return
+		}
+		b.sendText(msg.Chat.ID, msg.MessageID, "model set to "+arg)
+		return
+	}
+
+	reply := tgbotapi.NewMessage(msg.Chat.ID, "current model: "+b.chat.Model(msg.Chat.ID))
+	reply.ReplyToMessageID = msg.MessageID
+	reply.ReplyMarkup = b.modelKeyboard(msg.Chat.ID)
+	if _, err := b.api.Send(reply); err != nil {
+		log.Printf("failed to send model picker: %v", err)
+	}
+}
+
+func (b *Bot) handleModelCallback(query *tgbotapi.CallbackQuery, model string) {
+	chatID := query.Message.Chat.ID
+	if err := b.chat.SetModel(chatID, model); err != nil {
+		b.answerCallback(query.ID, "model is not available")
+		return
+	}
+	b.answerCallback(query.ID, "model set to "+model)
+
+	edit := tgbotapi.NewEditMessageTextAndMarkup(chatID, query.Message.MessageID,
+		"current model: "+model, b.modelKeyboard(chatID))
+	if _, err := b.api.Send(edit); err != nil {
+		log.Printf("failed to update model picker: %v", err)
+	}
+}
+
+func (b *Bot) modelKeyboard(chatID int64) tgbotapi.InlineKeyboardMarkup {
+	current := b.chat.Model(chatID)
+	rows := make([][]tgbotapi.InlineKeyboardButton, 0, len(b.chat.Models()))
+	for _, model := range b.chat.Models() {
+		label := model
+		if model == current {
+			label = "✓ " + model
+		}
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(label, callbackModelPrefix+model),
+		))
+	}
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+func (b *Bot) handleSystem(msg *tgbotapi.Message, arg string) {
+	switch strings.ToLower(arg) {
+	case "":
+		profile := b.chat.Profile(msg.Chat.ID)
+		b.sendText(msg.Chat.ID, msg.MessageID, "current system prompt:\n"+profile.Prompt+
+			"\n\nusage: /system <text> to replace it, /system reset to restore the default")
+	case "reset":
+		b.chat.SetSystemPrompt(msg.Chat.ID, "")
+		b.sendText(msg.Chat.ID, msg.MessageID, "system prompt restored")
+	default:
+		b.chat.SetSystemPrompt(msg.Chat.ID, arg)
+		b.sendText(msg.Chat.ID, msg.MessageID, "system prompt updated")
+	}
+}
+
+func (b *Bot) handlePersona(msg *tgbotapi.Message, arg string) {
+	personas := b.chat.Personas()
+	if len(personas) == 0 {
+		b.sendText(msg.Chat.ID, msg.MessageID, "no personas configured")
+		return
+	}
+
+	switch strings.ToLower(arg) {
+	case "":
+		current := b.chat.Profile(msg.Chat.ID).Persona
+		var sb strings.Builder
+		sb.WriteString("personas:")
+		for _, p := range personas {
+			marker := ""
+			if p.Name == current {
+				marker = " (current)"
+			}
+			fmt.Fprintf(&sb, "\n- %s%s", p.Name, marker)
+		}
+		sb.WriteString("\n\nusage: /persona <name>, /persona none to clear")
+		b.sendText(msg.Chat.ID, msg.MessageID, sb.String())
+	case "none":
+		_ = b.chat.SetPersona(msg.Chat.ID, "")
+		b.sendText(msg.Chat.ID, msg.MessageID, "persona cleared")
+	default:
+		if err := b.chat.SetPersona(msg.Chat.ID, arg); err != nil {
+			b.sendText(msg.Chat.ID, msg.MessageID, "unknown persona, send /persona to list them")
+			return
+		}
+		b.sendText(msg.Chat.ID, msg.MessageID, "persona set to "+strings.ToLower(arg))
+	}
+}
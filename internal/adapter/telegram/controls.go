@@ -0,0 +1,225 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"chatgpt-telegram-bot/internal/usecase/chat"
+	"chatgpt-telegram-bot/internal/usecase/quota"
+)
+
+const (
+	callbackRegenerate = "regenerate"
+	callbackContinue   = "continue"
+	callbackReadAloud  = "read_aloud"
+	callbackStop       = "stop"
+)
+
+// replyFunc produces a chat reply, streaming it through onDelta when it is set.
+type replyFunc func(ctx context.Context, onDelta func(delta string) error) (chat.Reply, error)
+
+func replyKeyboard(truncated bool) *tgbotapi.InlineKeyboardMarkup {
+	row := tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("🔄 Regenerate", callbackRegenerate),
+	)
+	if truncated {
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData("▶️ Continue", callbackContinue))
+	}
+	row = append(row, tgbotapi.NewInlineKeyboardButtonData("🔊 Read aloud", callbackReadAloud))
+	markup := tgbotapi.NewInlineKeyboardMarkup(row)
+	return &markup
+}
+
+func stopKeyboard() *tgbotapi.InlineKeyboardMarkup {
+	markup := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("⏹ Stop", callbackStop),
+	))
+	return &markup
+}
+
+// respond runs a chat reply in conv and sends it with reply buttons, streamed
+// when streaming is enabled and the answer is not requested as a file.
+func (b *Bot) respond(ctx context.Context, msg *tgbotapi.Message, conv chat.Conversation, asFile bool, run replyFunc) {
+	if b.cfg.StreamReplies && !asFile {
+		b.streamReply(ctx, msg, conv, run)
+		return
+	}
+
+	reply, err := run(ctx, nil)
+	if err != nil {
+		b.sendChatError(msg, err)
+		return
+	}
+	b.recordChatUsage(msg, reply)
+
+	markup := replyKeyboard(reply.Truncated)
+	var lastID int
+	if asFile || b.shouldSendAsFile(reply.Text) {
+		lastID, err = b.sendAsFile(msg.Chat.ID, msg.MessageID, reply.Text, markup)
+		if err != nil {
+			log.Printf("failed to send file: %v", err)
+			b.sendText(msg.Chat.ID, msg.MessageID, "could not send file, here is the text")
+			lastID = b.sendTextMarkup(msg.Chat.ID, msg.MessageID, reply.Text, markup)
+		}
+	} else {
+		lastID = b.sendTextMarkup(msg.Chat.ID, msg.MessageID, reply.Text, markup)
+	}
+	if lastID != 0 {
+		b.replies.add(conv, lastID, reply.Text)
+		b.chat.LinkReply(conv, reply, lastID)
+	}
+	b.sendTrimNotice(msg, reply)
+}
+
+func (b *Bot) streamReply(ctx context.Context, msg *tgbotapi.Message, conv chat.Conversation, run replyFunc) {
+	streamCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	w, err := b.newStreamWriter(msg.Chat.ID, msg.MessageID, stopKeyboard())
+	if err != nil {
+		log.Printf("failed to send placeholder: %v", err)
+		return
+	}
+	b.streams.start(msg.Chat.ID, w.messageID, msg.From.ID, cancel)
+	w.onRollover = func(prevID, messageID int) {
+		b.streams.move(msg.Chat.ID, prevID, messageID)
+	}
+	defer func() { b.streams.finish(msg.Chat.ID, w.messageID) }()
+
+	reply, err := run(streamCtx, w.Write)
+	switch {
+	case err == nil:
+	case errors.Is(err, context.Canceled) && ctx.Err() == nil:
+		// stopped with the button: keep what was written so far
+		if w.Text() == "" {
+			w.Fail("stopped")
+			return
+		}
+		lastID := w.Finish(replyKeyboard(false))
+		b.replies.add(conv, lastID, w.Text())
+		b.chat.LinkReply(conv, reply, lastID)
+		return
+	default:
+		w.Fail(chatErrorText(err))
+		return
+	}
+
+	lastID := w.Finish(replyKeyboard(reply.Truncated))
+	b.replies.add(conv, lastID, reply.Text)
+	b.chat.LinkReply(conv, reply, lastID)
+	b.recordChatUsage(msg, reply)
+	b.sendTrimNotice(msg, reply)
+}
+
+// callbackMessage presents a button press as a message from the user who
+// pressed it, replying to the message that carries the button.
+func callbackMessage(query *tgbotapi.CallbackQuery) *tgbotapi.Message {
+	return &tgbotapi.Message{
+		MessageID: query.Message.MessageID,
+		From:      query.From,
+		Chat:      query.Message.Chat,
+	}
+}
+
+// replyConversation resolves the conversation the reply carrying a button
+// belongs to and reports whether the presser may act on it: with per-member
+// group context only the member the reply answers may.
+func (b *Bot) replyConversation(query *tgbotapi.CallbackQuery) (chat.Conversation, bool) {
+	conv, ok := b.replies.conversation(query.Message.Chat.ID, query.Message.MessageID)
+	if !ok {
+		// forgotten since a restart: a reply to a message answers its sender
+		owner := query.Message.ReplyToMessage
+		if owner == nil || owner.From == nil || owner.From.ID == b.api.Self.ID {
+			// with no known owner only a shared conversation is safe to use
+			conv = b.conversation(callbackMessage(query))
+			return conv, conv.UserID == 0
+		}
+		conv = b.conversation(&tgbotapi.Message{Chat: query.Message.Chat, From: owner.From})
+	}
+	return conv, conv.UserID == 0 || conv.UserID == query.From.ID
+}
+
+func (b *Bot) handleRegenerate(ctx context.Context, query *tgbotapi.CallbackQuery) {
+	msg := callbackMessage(query)
+	conv, ok := b.replyConversation(query)
+	if !ok {
+		b.answerCallback(query.ID, "only the person this reply answers can regenerate it")
+		return
+	}
+	if b.chat.LatestReplyID(conv) != msg.MessageID {
+		b.answerCallback(query.ID, "only the latest reply can be regenerated")
+		return
+	}
+	b.answerCallback(query.ID, "")
+	if !b.allow(msg, quota.Request{}) {
+		return
+	}
+
+	b.sendChatAction(msg.Chat.ID, false)
+	b.respond(ctx, msg, conv, false, func(ctx context.Context, onDelta func(string) error) (chat.Reply, error) {
+		return b.chat.Regenerate(ctx, conv, onDelta)
+	})
+}
+
+func (b *Bot) handleContinue(ctx context.Context, query *tgbotapi.CallbackQuery) {
+	msg := callbackMessage(query)
+	conv, ok := b.replyConversation(query)
+	if !ok {
+		b.answerCallback(query.ID, "only the person this reply answers can continue it")
+		return
+	}
+	if b.chat.LatestReplyID(conv) != msg.MessageID {
+		b.answerCallback(query.ID, "only the latest reply can be continued")
+		return
+	}
+	b.answerCallback(query.ID, "")
+	if !b.allow(msg, quota.Request{}) {
+		return
+	}
+
+	b.sendChatAction(msg.Chat.ID, false)
+	b.respond(ctx, msg, conv, false, func(ctx context.Context, onDelta func(string) error) (chat.Reply, error) {
+		return b.chat.Continue(ctx, conv, onDelta)
+	})
+}
+
+func (b *Bot) handleReadAloud(ctx context.Context, query *tgbotapi.CallbackQuery) {
+	msg := callbackMessage(query)
+	text, ok := b.replies.text(msg.Chat.ID, msg.MessageID)
+	if !ok {
+		text = query.Message.Text
+	}
+	b.answerCallback(query.ID, "")
+	b.speak(ctx, msg, text)
+}
+
+// handleStop runs outside the chat's queue, which is busy with the reply it
+// interrupts.
+func (b *Bot) handleStop(query *tgbotapi.CallbackQuery) {
+	if query.Message == nil || query.From == nil {
+		b.answerCallback(query.ID, "")
+		return
+	}
+	if !isAllowedUser(query.From.ID, query.Message.Chat.ID, b.cfg) {
+		b.answerCallback(query.ID, "access denied")
+		return
+	}
+	chatID, messageID := query.Message.Chat.ID, query.Message.MessageID
+	owner, ok := b.streams.owner(chatID, messageID)
+	if !ok {
+		b.answerCallback(query.ID, "nothing to stop")
+		return
+	}
+	if owner != query.From.ID && !isAdmin(query.From.ID, b.cfg) {
+		b.answerCallback(query.ID, "only the person this reply answers can stop it")
+		return
+	}
+	if !b.streams.stop(chatID, messageID) {
+		b.answerCallback(query.ID, "nothing to stop")
+		return
+	}
+	b.answerCallback(query.ID, "stopped")
+}
@@ -0,0 +1,81 @@
+package telegram
+
+import (
+	"context"
+	"sync"
+)
+
+// dispatcher runs jobs on a bounded number of workers. Jobs of the same chat
+// run one after another in submission order; different chats run in parallel.
+type dispatcher struct {
+	workers chan struct{}
+	pending chan struct{}
+
+	mu     sync.Mutex
+	queues map[int64][]func()
+	wg     sync.WaitGroup
+}
+
+func newDispatcher(workers, queueSize int) *dispatcher {
+	if workers <= 0 {
+		workers = 1
+	}
+	if queueSize < 0 {
+		queueSize = 0
+	}
+	return &dispatcher{
+		workers: make(chan struct{}, workers),
+		pending: make(chan struct{}, workers+queueSize),
+		queues:  make(map[int64][]func()),
+	}
+}
+
+// Submit schedules job for chatID. It blocks only while the queue is full
+// and gives up when ctx is done; the job waits for a free worker on its own.
+func (d *dispatcher) Submit(ctx context.Context, chatID int64, job func()) error {
+	select {
+	case d.pending <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if queue, busy := d.queues[chatID]; busy {
+		d.queues[chatID] = append(queue, job)
+		return nil
+	}
+	d.queues[chatID] = []func(){}
+
+	d.wg.Add(1)
+	go d.work(chatID, job)
+	return nil
+}
+
+func (d *dispatcher) work(chatID int64, job func()) {
+	defer d.wg.Done()
+
+	d.workers <- struct{}{}
+	defer func() { <-d.workers }()
+
+	for job != nil {
+		job()
+		<-d.pending
+
+		d.mu.Lock()
+		queue := d.queues[chatID]
+		if len(queue) == 0 {
+			delete(d.queues, chatID)
+			job = nil
+		} else {
+			job = queue[0]
+			d.queues[chatID] = queue[1:]
+		}
+		d.mu.Unlock()
+	}
+}
+
+// Wait blocks until every submitted job has finished.
+func (d *dispatcher) Wait() {
+	d.wg.Wait()
+}
@@ -0,0 +1,140 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDispatcherRunsChatJobsInOrder(t *testing.T) {
+	d := newDispatcher(4, 16)
+
+	var (
+		mu      sync.Mutex
+		got     []int
+		running int
+	)
+	for i := range 10 {
+		err := d.Submit(context.Background(), 1, func() {
+			mu.Lock()
+			running++
+			if running > 1 {
+				t.Errorf("job %d ran while another job of the chat was running", i)
+			}
+			mu.Unlock()
+
+			time.Sleep(time.Millisecond)
+
+			mu.Lock()
+			running--
+			got = append(got, i)
+			mu.Unlock()
+		})
+		if err != nil {
+			t.Fatalf("Submit(%d) error = %v", i, err)
+		}
+	}
+	d.Wait()
+
+	for i, v := range got {
+		if v != i {
+			t.Fatalf("jobs ran in order %v, want submission order", got)
+		}
+	}
+	if len(got) != 10 {
+		t.Fatalf("%d jobs ran, want 10", len(got))
+	}
+}
+
+func TestDispatcherLimitsWorkers(t *testing.T) {
+	d := newDispatcher(2, 8)
+
+	release := make(chan struct{})
+	started := make(chan int64, 3)
+	for chatID := range int64(3) {
+		err := d.Submit(context.Background(), chatID, func() {
+			started <- chatID
+			<-release
+		})
+		if err != nil {
+			t.Fatalf("Submit(chat %d) error = %v", chatID, err)
+		}
+	}
+
+	for range 2 {
+		select {
+		case <-started:
+		case <-time.After(time.Second):
+			t.Fatal("two chats did not run in parallel")
+		}
+	}
+	select {
+	case chatID := <-started:
+		t.Fatalf("chat %d started while both workers were busy", chatID)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(release)
+	select {
+	case <-started:
+	case <-time.After(time.Second):
+		t.Fatal("third chat never got a worker")
+	}
+	d.Wait()
+}
+
+func TestDispatcherSubmitDoesNotWaitForWorker(t *testing.T) {
+	d := newDispatcher(1, 4)
+
+	release := make(chan struct{})
+	defer func() {
+		close(release)
+		d.Wait()
+	}()
+	if err := d.Submit(context.Background(), 1, func() { <-release }); err != nil {
+		t.Fatalf("Submit() error = %v", err)
+	}
+
+	// the only worker is busy, but the queue has room
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	submitted := make(chan error, 1)
+	go func() {
+		submitted <- d.Submit(ctx, 2, func() {})
+	}()
+
+	select {
+	case err := <-submitted:
+		if err != nil {
+			t.Fatalf("Submit() error = %v, want the job queued", err)
+		}
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("Submit() blocked waiting for a worker")
+	}
+}
+
+func TestDispatcherSubmitGivesUpWhenQueueFull(t *testing.T) {
+	d := newDispatcher(1, 1)
+
+	release := make(chan struct{})
+	for chatID := range int64(2) {
+		if err := d.Submit(context.Background(), chatID, func() { <-release }); err != nil {
+			t.Fatalf("Submit(chat %d) error = %v", chatID, err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	ran := false
+	if err := d.Submit(ctx, 3, func() { ran = true }); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Submit() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	close(release)
+	d.Wait()
+	if ran {
+		t.Fatal("rejected job ran")
+	}
+}
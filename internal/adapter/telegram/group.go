@@ -0,0 +1,149 @@
+package telegram
+
+import (
+	"log"
+	"regexp"
+	"strings"
+	"unicode/utf16"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"chatgpt-telegram-bot/internal/usecase/chat"
+)
+
+func isGroupChat(c *tgbotapi.Chat) bool {
+	return c != nil && (c.IsGroup() || c.IsSuperGroup())
+}
+
+// addressed reports whether msg is meant for the bot and returns it with the
+// bot's @mention removed from the text. Outside groups every message is.
+func (b *Bot) addressed(msg *tgbotapi.Message) (*tgbotapi.Message, bool) {
+	if !isGroupChat(msg.Chat) {
+		return msg, true
+	}
+
+	username := b.api.Self.UserName
+	if command, ok := commandWithAt(msg); ok {
+		// "/cmd@otherbot" belongs to another bot in the group
+		_, target, _ := strings.Cut(command, "@")
+		return msg, target == "" || strings.EqualFold(target, username)
+	}
+
+	mentioned := hasMention(msg.Text, msg.Entities, username) ||
+		hasMention(msg.Caption, msg.CaptionEntities, username)
+	if !mentioned && !b.repliesToBot(msg) && b.chat.GroupPolicy(msg.Chat.ID).ReplyMode != chat.GroupReplyAll {
+		return msg, false
+	}
+	if !mentioned {
+		return msg, true
+	}
+
+	stripped := *msg
+	stripped.Text = stripMention(msg.Text, username)
+	stripped.Caption = stripMention(msg.Caption, username)
+	return &stripped, true
+}
+
+func (b *Bot) repliesToBot(msg *tgbotapi.Message) bool {
+	return msg.ReplyToMessage != nil && msg.ReplyToMessage.From != nil &&
+		msg.ReplyToMessage.From.ID == b.api.Self.ID
+}
+
+// commandWithAt returns the command a message or its caption starts with,
+// including any @bot suffix.
+func commandWithAt(msg *tgbotapi.Message) (string, bool) {
+	if msg.IsCommand() {
+		return msg.CommandWithAt(), true
+	}
+	if len(msg.CaptionEntities) == 0 {
+		return "", false
+	}
+	entity := msg.CaptionEntities[0]
+	units := utf16.Encode([]rune(msg.Caption))
+	if !entity.IsCommand() || entity.Offset != 0 || entity.Length > len(units) {
+		return "", false
+	}
+	return string(utf16.Decode(units[1:entity.Length])), true
+}
+
+func hasMention(text string, entities []tgbotapi.MessageEntity, username string) bool {
+	if username == "" {
+		return false
+	}
+	units := utf16.Encode([]rune(text))
+	for _, e := range entities {
+		if e.Type != "mention" || e.Offset < 0 || e.Offset+e.Length > len(units) {
+			continue
+		}
+		mention := string(utf16.Decode(units[e.Offset : e.Offset+e.Length]))
+		if strings.EqualFold(mention, "@"+username) {
+			return true
+		}
+	}
+	return false
+}
+
+func stripMention(text, username string) string {
+	if text == "" {
+		return text
+	}
+	re := regexp.MustCompile(`(?i)@` + regexp.QuoteMeta(username) + `\b`)
+	return strings.TrimSpace(re.ReplaceAllString(text, ""))
+}
+
+// conversation picks the history msg belongs to: the chat's, or the sender's
+// own when the group keeps a context per member.
+func (b *Bot) conversation(msg *tgbotapi.Message) chat.Conversation {
+	conv := chat.Conversation{ChatID: msg.Chat.ID}
+	if isGroupChat(msg.Chat) && b.chat.GroupPolicy(msg.Chat.ID).Context == chat.GroupContextUser {
+		conv.UserID = msg.From.ID
+	}
+	return conv
+}
+
+func (b *Bot) handleGroup(msg *tgbotapi.Message, arg string) {
+	if !isGroupChat(msg.Chat) {
+		b.sendText(msg.Chat.ID, msg.MessageID, "group settings only apply to group chats")
+		return
+	}
+
+	arg = strings.ToLower(arg)
+	if arg == "" {
+		policy := b.chat.GroupPolicy(msg.Chat.ID)
+		b.sendText(msg.Chat.ID, msg.MessageID,
+			"replies: "+policy.ReplyMode+"\ncontext: "+policy.Context+
+				"\n\nusage: /group mention|all to answer only when addressed or every message,"+
+				" /group shared|user to share one context or keep one per member")
+		return
+	}
+	if !b.isChatAdmin(msg) {
+		b.sendText(msg.Chat.ID, msg.MessageID, "only group admins can change group settings")
+		return
+	}
+
+	switch arg {
+	case chat.GroupReplyMention, chat.GroupReplyAll:
+		_ = b.chat.SetGroupReplyMode(msg.Chat.ID, arg)
+		b.sendText(msg.Chat.ID, msg.MessageID, "replies set to "+arg)
+	case chat.GroupContextShared, chat.GroupContextUser:
+		_ = b.chat.SetGroupContext(msg.Chat.ID, arg)
+		b.sendText(msg.Chat.ID, msg.MessageID, "context set to "+arg)
+	default:
+		b.sendText(msg.Chat.ID, msg.MessageID, "usage: /group [mention|all|shared|user]")
+	}
+}
+
+// isChatAdmin reports whether the sender administers the chat, or is a bot admin.
+func (b *Bot) isChatAdmin(msg *tgbotapi.Message) bool {
+	if isAdmin(msg.From.ID, b.cfg) {
+		return true
+	}
+	member, err := b.api.GetChatMember(tgbotapi.GetChatMemberConfig{
+		ChatConfigWithUser: tgbotapi.ChatConfigWithUser{ChatID: msg.Chat.ID, UserID: msg.From.ID},
+	})
+	if err != nil {
+		log.Printf("failed to get chat member %d in chat %d: %v", msg.From.ID, msg.Chat.ID, err)
+		return false
+	}
+	return member.IsCreator() || member.IsAdministrator()
+}
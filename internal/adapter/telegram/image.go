@@ -0,0 +1,101 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	imagegen "chatgpt-telegram-bot/internal/usecase/image"
+	"chatgpt-telegram-bot/internal/usecase/quota"
+)
+
+// handleImage draws an image for prompt, or edits the picture the message
+// replies to or carries.
+func (b *Bot) handleImage(ctx context.Context, msg *tgbotapi.Message, prompt string) {
+	if strings.TrimSpace(prompt) == "" {
+		b.sendText(msg.Chat.ID, msg.MessageID, "usage: /img <prompt>, or reply with it to a photo to edit the photo")
+		return
+	}
+	if !b.allow(msg, quota.Request{Images: 1}) {
+		return
+	}
+
+	b.sendPhotoAction(msg.Chat.ID)
+	images, mask, err := b.editImages(msg)
+	if err != nil {
+		log.Printf("could not fetch image to edit: %v", err)
+		b.sendText(msg.Chat.ID, msg.MessageID, "could not download the image to edit")
+		return
+	}
+
+	var imageResp imagegen.Response
+	if len(images) > 0 {
+		imageResp, err = b.img.Edit(ctx, prompt, images, mask)
+	} else {
+		imageResp, err = b.img.Generate(ctx, prompt)
+	}
+	if err != nil {
+		if errors.Is(err, imagegen.ErrEmptyPrompt) {
+			b.sendText(msg.Chat.ID, msg.MessageID, "i need a prompt to generate an image")
+			return
+		}
+		log.Printf("image generation failed: %v", err)
+		b.sendText(msg.Chat.ID, msg.MessageID, providerErrorText(err, "failed to generate image, try again later"))
+		return
+	}
+	b.usage.RecordImage(msg.From.ID, msg.Chat.ID, b.cfg.ImageModel, 1)
+
+	if err := b.sendImage(msg.Chat.ID, msg.MessageID, imageResp); err != nil {
+		log.Printf("failed to send image: %v", err)
+		b.sendText(msg.Chat.ID, msg.MessageID, "could not send image")
+	}
+}
+
+type imageFile struct {
+	fileID   string
+	mimeType string
+	document bool
+}
+
+// editImages collects the pictures an /img request works on as data URLs:
+// the one it replies to and the one attached to it. A PNG document sent in
+// reply to a picture is the mask for that picture instead.
+func (b *Bot) editImages(msg *tgbotapi.Message) (images []string, mask string, err error) {
+	replied, hasReplied := findImage(msg.ReplyToMessage)
+	attached, hasAttached := findImage(msg)
+
+	if hasReplied {
+		dataURL, err := b.fetchDataURL(replied.fileID, replied.mimeType)
+		if err != nil {
+			return nil, "", err
+		}
+		images = append(images, dataURL)
+	}
+	if hasAttached {
+		dataURL, err := b.fetchDataURL(attached.fileID, attached.mimeType)
+		if err != nil {
+			return nil, "", err
+		}
+		if hasReplied && attached.document && attached.mimeType == "image/png" {
+			return images, dataURL, nil
+		}
+		images = append(images, dataURL)
+	}
+	return images, "", nil
+}
+
+func findImage(msg *tgbotapi.Message) (imageFile, bool) {
+	switch {
+	case msg == nil:
+		return imageFile{}, false
+	case len(msg.Photo) > 0:
+		return imageFile{fileID: msg.Photo[len(msg.Photo)-1].FileID, mimeType: "image/jpeg"}, true
+	case msg.Document != nil && strings.HasPrefix(msg.Document.MimeType, "image/"):
+		return imageFile{fileID: msg.Document.FileID, mimeType: msg.Document.MimeType, document: true}, true
+	default:
+		return imageFile{}, false
+	}
+}
@@ -0,0 +1,59 @@
+package telegram
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"chatgpt-telegram-bot/internal/usecase/quota"
+)
+
+// allow charges a request against the sender's limits and, when it does not
+// fit, tells them when they can try again.
+func (b *Bot) allow(msg *tgbotapi.Message, req quota.Request) bool {
+	err := b.quota.Allow(msg.From.ID, msg.Chat.ID, req)
+	if err == nil {
+		return true
+	}
+
+	var limitErr *quota.LimitError
+	if !errors.As(err, &limitErr) {
+		log.Printf("quota check failed: %v", err)
+		return true
+	}
+	b.sendText(msg.Chat.ID, msg.MessageID, limitText(limitErr, b.now()))
+	return false
+}
+
+func limitText(err *quota.LimitError, now time.Time) string {
+	wait := formatWait(err.ResetAt.Sub(now))
+	switch err.Limit {
+	case quota.LimitUserRate:
+		return fmt.Sprintf("you are sending requests too fast, try again in %s", wait)
+	case quota.LimitChatRate:
+		return fmt.Sprintf("this chat is sending requests too fast, try again in %s", wait)
+	case quota.LimitDailyRequests:
+		return fmt.Sprintf("you have reached your daily request limit, it resets in %s", wait)
+	case quota.LimitDailyImages:
+		return fmt.Sprintf("you have reached your daily image limit, it resets in %s", wait)
+	case quota.LimitDailyTTSChars:
+		return fmt.Sprintf("this would exceed your daily text-to-speech limit, it resets in %s", wait)
+	default:
+		return fmt.Sprintf("limit reached, try again in %s", wait)
+	}
+}
+
+func formatWait(d time.Duration) string {
+	if d < time.Minute {
+		secs := int((d + time.Second - 1) / time.Second)
+		return fmt.Sprintf("%ds", max(secs, 1))
+	}
+	d = d.Round(time.Minute)
+	if d < time.Hour {
+		return fmt.Sprintf("%dm", int(d/time.Minute))
+	}
+	return fmt.Sprintf("%dh %dm", int(d/time.Hour), int(d%time.Hour/time.Minute))
+}
@@ -0,0 +1,251 @@
+package telegram
+
+import (
+	"html"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+var (
+	fencePattern   = regexp.MustCompile("^\\s*(```+|~~~+)\\s*([\\w+#.-]*)")
+	headingPattern = regexp.MustCompile(`^\s{0,3}#{1,6}\s+(.*?)\s*#*\s*$`)
+	bulletPattern  = regexp.MustCompile(`^(\s*)[-*+]\s+(.*)$`)
+	rulePattern    = regexp.MustCompile(`^\s{0,3}([-*_])(\s*([-*_])){2,}\s*$`)
+)
+
+// renderHTML converts the Markdown models write into the HTML subset
+// Telegram accepts. Formatting never spans lines, so any line boundary
+// outside a code block is a safe place to split a reply, and the rendered
+// text is never longer than md. Unclosed code blocks run to the end of the
+// text.
+func renderHTML(md string) string {
+	var (
+		sb      strings.Builder
+		fence   string
+		inQuote bool
+		newline bool
+	)
+	for _, line := range strings.Split(md, "\n") {
+		if fence != "" {
+			if isFenceClose(line, fence) {
+				sb.WriteString("</code></pre>")
+				fence = ""
+				continue
+			}
+			if newline {
+				sb.WriteByte('\n')
+			}
+			sb.WriteString(html.EscapeString(line))
+			newline = true
+			continue
+		}
+
+		quoted := strings.HasPrefix(strings.TrimLeft(line, " "), ">")
+		if inQuote && !quoted {
+			sb.WriteString("</blockquote>")
+			inQuote = false
+		}
+		if newline {
+			sb.WriteByte('\n')
+		}
+		newline = true
+
+		if m := fencePattern.FindStringSubmatch(line); m != nil {
+			fence = m[1]
+			if m[2] != "" {
+				sb.WriteString(`<pre><code class="language-` + html.EscapeString(m[2]) + `">`)
+			} else {
+				sb.WriteString("<pre><code>")
+			}
+			newline = false
+			continue
+		}
+
+		switch {
+		case quoted:
+			if !inQuote {
+				sb.WriteString("<blockquote>")
+				inQuote = true
+			}
+			text := strings.TrimPrefix(strings.TrimLeft(line, " "), ">")
+			sb.WriteString(renderInline(strings.TrimPrefix(text, " ")))
+		case headingPattern.MatchString(line):
+			sb.WriteString("<b>" + renderInline(headingPattern.FindStringSubmatch(line)[1]) + "</b>")
+		case rulePattern.MatchString(line):
+			sb.WriteString("———")
+		case bulletPattern.MatchString(line):
+			m := bulletPattern.FindStringSubmatch(line)
+			sb.WriteString(m[1] + "• " + renderInline(m[2]))
+		default:
+			sb.WriteString(renderInline(line))
+		}
+	}
+	if inQuote {
+		sb.WriteString("</blockquote>")
+	}
+	if fence != "" {
+		sb.WriteString("</code></pre>")
+	}
+	return sb.String()
+}
+
+func isFenceClose(line, fence string) bool {
+	trimmed := strings.TrimSpace(line)
+	return strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]) == ""
+}
+
+var inlineTags = []struct {
+	marker string
+	tag    string
+}{
+	{"**", "b"},
+	{"__", "b"},
+	{"~~", "s"},
+	{"*", "i"},
+	{"_", "i"},
+}
+
+// renderInline renders code spans, emphasis and links of a single line.
+// Markers without a matching close are kept as text.
+func renderInline(text string) string {
+	var sb strings.Builder
+	runes := []rune(text)
+	plainFrom := 0
+	flush := func(to int) {
+		sb.WriteString(html.EscapeString(string(runes[plainFrom:to])))
+	}
+
+	for i := 0; i < len(runes); {
+		switch runes[i] {
+		case '`':
+			n := runLength(runes, i, '`')
+			if end := findRun(runes, i+n, '`', n); end >= 0 {
+				flush(i)
+				code := strings.TrimSpace(string(runes[i+n : end]))
+				sb.WriteString("<code>" + html.EscapeString(code) + "</code>")
+				i = end + n
+				plainFrom = i
+				continue
+			}
+			i += n
+			continue
+		case '[':
+			if label, url, end, ok := parseLink(runes, i); ok {
+				flush(i)
+				sb.WriteString(`<a href="` + html.EscapeString(url) + `">` + renderInline(label) + "</a>")
+				i = end
+				plainFrom = i
+				continue
+			}
+		case '*', '_', '~':
+			if tag, inner, end, ok := parseEmphasis(runes, i); ok {
+				flush(i)
+				sb.WriteString("<" + tag + ">" + renderInline(inner) + "</" + tag + ">")
+				i = end
+				plainFrom = i
+				continue
+			}
+		}
+		i++
+	}
+	flush(len(runes))
+	return sb.String()
+}
+
+func parseEmphasis(runes []rune, i int) (tag, inner string, end int, ok bool) {
+	for _, it := range inlineTags {
+		marker := []rune(it.marker)
+		if !hasRunesAt(runes, i, marker) {
+			continue
+		}
+		start := i + len(marker)
+		// an opener is followed by text, and underscores inside words are literal
+		if start >= len(runes) || unicode.IsSpace(runes[start]) {
+			continue
+		}
+		if marker[0] == '_' && i > 0 && isWordRune(runes[i-1]) {
+			continue
+		}
+		for j := start + 1; j < len(runes); j++ {
+			if runes[j] != marker[0] || runes[j-1] == marker[0] || unicode.IsSpace(runes[j-1]) {
+				continue
+			}
+			// a closer is a whole run: "**" closes only bold, "***" closes
+			// both emphases with the inner one first
+			n := runLength(runes, j, marker[0])
+			if n != len(marker) && n != 3 {
+				continue
+			}
+			after := j + n
+			if marker[0] == '_' && after < len(runes) && isWordRune(runes[after]) {
+				continue
+			}
+			return it.tag, string(runes[start : after-len(marker)]), after, true
+		}
+	}
+	return "", "", 0, false
+}
+
+func parseLink(runes []rune, i int) (label, url string, end int, ok bool) {
+	closeLabel := -1
+	for j := i + 1; j < len(runes); j++ {
+		if runes[j] == ']' {
+			closeLabel = j
+			break
+		}
+	}
+	if closeLabel < 0 || closeLabel+1 >= len(runes) || runes[closeLabel+1] != '(' {
+		return "", "", 0, false
+	}
+	for j := closeLabel + 2; j < len(runes); j++ {
+		if runes[j] == ')' {
+			url = strings.TrimSpace(string(runes[closeLabel+2 : j]))
+			if url == "" || strings.ContainsAny(url, " \t") {
+				return "", "", 0, false
+			}
+			return string(runes[i+1 : closeLabel]), url, j + 1, true
+		}
+	}
+	return "", "", 0, false
+}
+
+func runLength(runes []rune, i int, r rune) int {
+	n := 0
+	for i+n < len(runes) && runes[i+n] == r {
+		n++
+	}
+	return n
+}
+
+// findRun returns the start of the next run of exactly n r runes at or after i.
+func findRun(runes []rune, i int, r rune, n int) int {
+	for i < len(runes) {
+		if runes[i] != r {
+			i++
+			continue
+		}
+		m := runLength(runes, i, r)
+		if m == n {
+			return i
+		}
+		i += m
+	}
+	return -1
+}
+
+func hasRunesAt(runes []rune, i int, want []rune) bool {
+	if i+len(want) > len(runes) {
+		return false
+	}
+	for k, r := range want {
+		if runes[i+k] != r {
+			return false
+		}
+	}
+	return true
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
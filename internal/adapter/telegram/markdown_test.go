@@ -0,0 +1,78 @@
+package telegram
+
+import "testing"
+
+func TestRenderInline(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"plain", "just text", "just text"},
+		{"escapes html", "a < b && c > d", "a &lt; b &amp;&amp; c &gt; d"},
+		{"escapes quotes", `"q" 'x'`, "&#34;q&#34; &#39;x&#39;"},
+		{"bold", "**bold** and __bold__", "<b>bold</b> and <b>bold</b>"},
+		{"italic", "*it* and _it_", "<i>it</i> and <i>it</i>"},
+		{"strike", "~~gone~~", "<s>gone</s>"},
+		{"escapes inside emphasis", "**a < b**", "<b>a &lt; b</b>"},
+		{"italic inside bold", "**bold _and italic_**", "<b>bold <i>and italic</i></b>"},
+		{"bold inside italic", "*it **b** it*", "<i>it <b>b</b> it</i>"},
+		{"shared closer", "**bold *it***", "<b>bold <i>it</i></b>"},
+		{"bold italic", "***both***", "<b><i>both</i></b>"},
+		{"unclosed", "**unclosed and *open", "**unclosed and *open"},
+		{"spaced asterisks", "2 * 3 * 4", "2 * 3 * 4"},
+		{"no line spanning", "**a", "**a"},
+		{"underscores inside words", "snake_case_name", "snake_case_name"},
+		{"underscore inside emphasis", "_a_b_", "<i>a_b</i>"},
+		{"italic next to word underscore", "_it_ and foo_bar", "<i>it</i> and foo_bar"},
+		{"code", "`a < b`", "<code>a &lt; b</code>"},
+		{"no emphasis in code", "`**not bold**`", "<code>**not bold**</code>"},
+		{"double backtick code", "``has ` tick``", "<code>has ` tick</code>"},
+		{"unclosed code", "`open", "`open"},
+		{"link", "[site](https://example.com)", `<a href="https://example.com">site</a>`},
+		{"link query escaped", "[q](https://x.io/?a=1&b=2)", `<a href="https://x.io/?a=1&amp;b=2">q</a>`},
+		{"link quote escaped", `[x](http://a"b)`, `<a href="http://a&#34;b">x</a>`},
+		{"formatted link label", "[**bold** link](http://x)", `<a href="http://x"><b>bold</b> link</a>`},
+		{"empty url", "[text]()", "[text]()"},
+		{"url with space", "[text](a b)", "[text](a b)"},
+		{"label without url", "[text] (http://x)", "[text] (http://x)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := renderInline(tt.in); got != tt.want {
+				t.Fatalf("renderInline(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderHTML(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"paragraphs", "a\n\nb", "a\n\nb"},
+		{"heading", "# Title", "<b>Title</b>"},
+		{"closed heading", "## Title ##", "<b>Title</b>"},
+		{"bullets", "- one\n* two\n  + nested", "• one\n• two\n  • nested"},
+		{"rule", "---", "———"},
+		{"quote", "> quote\n> more\nafter", "<blockquote>quote\nmore</blockquote>\nafter"},
+		{"quote at end", "> **q**", "<blockquote><b>q</b></blockquote>"},
+		{"no line spanning", "**a\nb**", "**a\nb**"},
+		{"fence", "```\nx := 1 < 2\n```", "<pre><code>x := 1 &lt; 2</code></pre>"},
+		{"fence language", "```go\nfmt.Println()\n```", `<pre><code class="language-go">fmt.Println()</code></pre>`},
+		{"no markdown in fence", "```\n**not bold**\n# no\n```\nafter **b**", "<pre><code>**not bold**\n# no</code></pre>\nafter <b>b</b>"},
+		{"tilde fence", "~~~\ncode\n~~~", "<pre><code>code</code></pre>"},
+		{"shorter fence stays code", "````\n```\n````", "<pre><code>```</code></pre>"},
+		{"unclosed fence", "text\n```python\nprint(1)\n\nprint(2)", "text\n<pre><code class=\"language-python\">print(1)\n\nprint(2)</code></pre>"},
+		{"fence closes quote", "> q\n```\nc\n```", "<blockquote>q</blockquote>\n<pre><code>c</code></pre>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := renderHTML(tt.in); got != tt.want {
+				t.Fatalf("renderHTML(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
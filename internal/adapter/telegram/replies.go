@@ -0,0 +1,129 @@
+package telegram
+
+import (
+	"context"
+	"sync"
+
+	"chatgpt-telegram-bot/internal/usecase/chat"
+)
+
+// replyLogSize bounds how many replies the bot remembers across all chats.
+const replyLogSize = 1000
+
+type replyKey struct {
+	chatID    int64
+	messageID int
+}
+
+type replyRecord struct {
+	text string
+	conv chat.Conversation
+}
+
+// replyLog remembers the full text behind recent replies, so buttons work
+// for replies split over several messages, and the conversation each reply
+// belongs to. It lives in memory; after a restart buttons fall back to the
+// message itself.
+type replyLog struct {
+	mu      sync.Mutex
+	records map[replyKey]replyRecord
+	order   []replyKey
+}
+
+func (l *replyLog) add(conv chat.Conversation, messageID int, text string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.records == nil {
+		l.records = make(map[replyKey]replyRecord)
+	}
+	key := replyKey{chatID: conv.ChatID, messageID: messageID}
+	if _, ok := l.records[key]; !ok {
+		l.order = append(l.order, key)
+	}
+	l.records[key] = replyRecord{text: text, conv: conv}
+
+	for len(l.order) > replyLogSize {
+		delete(l.records, l.order[0])
+		l.order = l.order[1:]
+	}
+}
+
+func (l *replyLog) text(chatID int64, messageID int) (string, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	record, ok := l.records[replyKey{chatID: chatID, messageID: messageID}]
+	return record.text, ok
+}
+
+// conversation returns the conversation the reply ending at messageID belongs to.
+func (l *replyLog) conversation(chatID int64, messageID int) (chat.Conversation, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	record, ok := l.records[replyKey{chatID: chatID, messageID: messageID}]
+	return record.conv, ok
+}
+
+// streamRegistry holds the replies being streamed, keyed by the message that
+// carries their stop button, so the button can interrupt them.
+type streamRegistry struct {
+	mu      sync.Mutex
+	streams map[replyKey]activeStream
+}
+
+type activeStream struct {
+	userID int64
+	cancel context.CancelFunc
+}
+
+// start registers a stream answering userID whose stop button is on messageID.
+func (r *streamRegistry) start(chatID int64, messageID int, userID int64, cancel context.CancelFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.streams == nil {
+		r.streams = make(map[replyKey]activeStream)
+	}
+	r.streams[replyKey{chatID: chatID, messageID: messageID}] = activeStream{userID: userID, cancel: cancel}
+}
+
+// move follows the stop button to the next message of a long reply.
+func (r *streamRegistry) move(chatID int64, from, to int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := replyKey{chatID: chatID, messageID: from}
+	if stream, ok := r.streams[key]; ok {
+		delete(r.streams, key)
+		r.streams[replyKey{chatID: chatID, messageID: to}] = stream
+	}
+}
+
+func (r *streamRegistry) finish(chatID int64, messageID int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.streams, replyKey{chatID: chatID, messageID: messageID})
+}
+
+// owner returns the user the stream with its stop button on messageID answers.
+func (r *streamRegistry) owner(chatID int64, messageID int) (int64, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stream, ok := r.streams[replyKey{chatID: chatID, messageID: messageID}]
+	return stream.userID, ok
+}
+
+func (r *streamRegistry) stop(chatID int64, messageID int) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stream, ok := r.streams[replyKey{chatID: chatID, messageID: messageID}]
+	if ok {
+		stream.cancel()
+	}
+	return ok
+}
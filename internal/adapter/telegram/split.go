@@ -0,0 +1,190 @@
+package telegram
+
+import (
+	"strings"
+	"unicode/utf16"
+)
+
+// messageLimit is Telegram's limit on the text of a message, counted in
+// UTF-16 code units.
+const messageLimit = 4096
+
+// codeBlock is a fenced code block of a text in rune offsets: the opening
+// fence line starts at start, the code at body and the closing fence line at
+// close; end is where that line ends. Unclosed blocks run to the end.
+type codeBlock struct {
+	open  string
+	fence string
+	start int
+	body  int
+	close int
+	end   int
+}
+
+// cutMarkdown splits off a head that fits in size UTF-16 units. It cuts at
+// a paragraph break or around a code block if it can, then at a line break,
+// a line inside a code block, the end of a sentence, a space, and only then
+// mid-word. A code block cut in two is closed in head and reopened in rest.
+func cutMarkdown(text string, size int) (head, rest string) {
+	runes := []rune(text)
+	limit := fitUnits(runes, size)
+	if limit == len(runes) {
+		return text, ""
+	}
+
+	blocks := findCodeBlocks(runes)
+	cut, skip := bestCut(runes, limit, blocks)
+	block := blockAt(blocks, cut)
+	if block != nil {
+		// leave room for the closing fence
+		limit = fitUnits(runes, size-len(block.fence)-1)
+		cut, skip = bestCut(runes, limit, blocks)
+		block = blockAt(blocks, cut)
+	}
+
+	head = strings.TrimRight(string(runes[:cut]), "\n")
+	rest = string(runes[cut+skip:])
+	if block != nil && cut >= block.body {
+		head += "\n" + block.fence
+		rest = block.open + "\n" + rest
+	}
+	return head, rest
+}
+
+// splitMarkdown cuts text into messages with cutMarkdown.
+func splitMarkdown(text string, size int) []string {
+	if size <= 0 {
+		return []string{text}
+	}
+	var chunks []string
+	for {
+		head, rest := cutMarkdown(text, size)
+		chunks = append(chunks, head)
+		if rest == "" {
+			return chunks
+		}
+		text = rest
+	}
+}
+
+// bestCut picks where to end a head of at most limit runes and how many
+// separator runes to drop after it. It never cuts in the first half.
+func bestCut(runes []rune, limit int, blocks []codeBlock) (cut, skip int) {
+	floor := limit / 2
+	find := func(ok func(i int) bool) int {
+		for i := limit; i > floor; i-- {
+			if ok(i) {
+				return i
+			}
+		}
+		return -1
+	}
+	outside := func(i int) bool {
+		return blockAt(blocks, i) == nil
+	}
+	inBody := func(i int) bool {
+		b := blockAt(blocks, i)
+		return b != nil && i >= b.body && i+1 < b.close
+	}
+
+	if i := find(func(i int) bool {
+		return runes[i] == '\n' && outside(i) &&
+			(i+1 < len(runes) && runes[i+1] == '\n' || isBlockEdge(blocks, i))
+	}); i >= 0 {
+		n := 0
+		for i+n < len(runes) && runes[i+n] == '\n' {
+			n++
+		}
+		return i, n
+	}
+	if i := find(func(i int) bool { return runes[i] == '\n' && outside(i) }); i >= 0 {
+		return i, 1
+	}
+	if i := find(func(i int) bool { return runes[i] == '\n' && inBody(i) }); i >= 0 {
+		return i, 1
+	}
+	if i := find(func(i int) bool {
+		return runes[i] == ' ' && strings.ContainsRune(".!?…", runes[i-1]) && outside(i)
+	}); i >= 0 {
+		return i, 1
+	}
+	if i := find(func(i int) bool { return runes[i] == ' ' && (outside(i) || inBody(i)) }); i >= 0 {
+		return i, 1
+	}
+	return limit, 0
+}
+
+func findCodeBlocks(runes []rune) []codeBlock {
+	var (
+		blocks []codeBlock
+		cur    *codeBlock
+	)
+	for pos := 0; pos <= len(runes); {
+		lineEnd := pos
+		for lineEnd < len(runes) && runes[lineEnd] != '\n' {
+			lineEnd++
+		}
+		line := string(runes[pos:lineEnd])
+		switch {
+		case cur != nil && isFenceClose(line, cur.fence):
+			cur.close, cur.end = pos, lineEnd
+			blocks = append(blocks, *cur)
+			cur = nil
+		case cur == nil:
+			if m := fencePattern.FindStringSubmatch(line); m != nil {
+				cur = &codeBlock{
+					open:  strings.TrimSpace(line),
+					fence: m[1],
+					start: pos,
+					body:  min(lineEnd+1, len(runes)),
+				}
+			}
+		}
+		pos = lineEnd + 1
+	}
+	if cur != nil {
+		cur.close, cur.end = len(runes), len(runes)
+		blocks = append(blocks, *cur)
+	}
+	return blocks
+}
+
+// blockAt returns the code block a cut at i would split.
+func blockAt(blocks []codeBlock, i int) *codeBlock {
+	for idx := range blocks {
+		if b := &blocks[idx]; b.start < i && i < b.end {
+			return b
+		}
+	}
+	return nil
+}
+
+// isBlockEdge reports whether the line break at i starts or ends a code block.
+func isBlockEdge(blocks []codeBlock, i int) bool {
+	for _, b := range blocks {
+		if i+1 == b.start || i == b.end {
+			return true
+		}
+	}
+	return false
+}
+
+// fitUnits returns how many of runes fit in size UTF-16 units.
+func fitUnits(runes []rune, size int) int {
+	units := 0
+	for n, r := range runes {
+		units += max(utf16.RuneLen(r), 1)
+		if units > size {
+			return n
+		}
+	}
+	return len(runes)
+}
+
+func utf16Len(runes []rune) int {
+	units := 0
+	for _, r := range runes {
+		units += max(utf16.RuneLen(r), 1)
+	}
+	return units
+}
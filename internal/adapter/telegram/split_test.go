@@ -0,0 +1,141 @@
+package telegram
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestBestCut(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		limit    int
+		wantCut  int
+		wantSkip int
+	}{
+		{"paragraph break", "aaaaaaa\n\n\nbb cc", 13, 8, 2},
+		{"line break before sentence end", "aaaa. bbbbbbb\ncc. dd", 18, 13, 1},
+		{"sentence end before space", "aaaaaaa bb. cc dd", 15, 11, 1},
+		{"space", "aaaaaaa bb cc dd", 15, 13, 1},
+		{"mid-word", "aaaaaaaaaaaaaaaaaa", 15, 15, 0},
+		{"never in the first half", "aa bbbbbbbbbbbbbbbbbb", 15, 15, 0},
+		{"after a code block", "```\ncode\n```\nmore text", 14, 12, 1},
+		{"line inside a code block", "aaaa\n```\nx\ny\n```", 13, 10, 1},
+		{"space inside a code block", "aaaaaaa\n```\nxx yy zz", 19, 17, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runes := []rune(tt.text)
+			cut, skip := bestCut(runes, tt.limit, findCodeBlocks(runes))
+			if cut != tt.wantCut || skip != tt.wantSkip {
+				t.Fatalf("bestCut() = %d, %d (head %q); want %d, %d",
+					cut, skip, string(runes[:cut]), tt.wantCut, tt.wantSkip)
+			}
+		})
+	}
+}
+
+func TestCutMarkdown(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		size     int
+		wantHead string
+		wantRest string
+	}{
+		{"fits", "short", 10, "short", ""},
+		{"line break past the first half", "first para\n\nsecond line\nthird", 26, "first para\n\nsecond line", "third"},
+		{"after a code block", "text\n\n```\ncode\n```\nafter the block", 20, "text\n\n```\ncode\n```", "after the block"},
+		{"fence closed and reopened", "intro text\n```go\nx := 1\ny := 2\n```\noutro", 30,
+			"intro text\n```go\nx := 1\n```", "```go\ny := 2\n```\noutro"},
+		{"room for the closing fence", "intro\n```go\nline one\nline two\nline three\nline four\n```", 35,
+			"intro\n```go\nline one\nline two\n```", "```go\nline three\nline four\n```"},
+		{"unclosed fence reopened", "```\naaaa\nbbbb\ncccc", 15, "```\naaaa\n```", "```\nbbbb\ncccc"},
+		{"astral rune past the limit", "abc😀def", 4, "abc", "😀def"},
+		{"astral rune at the limit", "abc😀def", 5, "abc😀", "def"},
+		{"astral runes only", strings.Repeat("😀", 10), 5, "😀😀", strings.Repeat("😀", 8)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			head, rest := cutMarkdown(tt.text, tt.size)
+			if head != tt.wantHead || rest != tt.wantRest {
+				t.Fatalf("cutMarkdown() = %q, %q; want %q, %q", head, rest, tt.wantHead, tt.wantRest)
+			}
+			if n := utf16Len([]rune(head)); n > tt.size {
+				t.Fatalf("head takes %d UTF-16 units, limit %d", n, tt.size)
+			}
+		})
+	}
+}
+
+func TestSplitMarkdownLongCodeBlock(t *testing.T) {
+	var code []string
+	for i := range 300 {
+		code = append(code, fmt.Sprintf("fmt.Println(%d) // 😀 done", i))
+	}
+	text := "Here is the code:\n\n```go\n" + strings.Join(code, "\n") + "\n```\n\nDone."
+
+	const size = 512
+	chunks := splitMarkdown(text, size)
+	if len(chunks) < 2 {
+		t.Fatalf("splitMarkdown() returned %d chunks, want several", len(chunks))
+	}
+
+	var got []string
+	for i, chunk := range chunks {
+		if n := utf16Len([]rune(chunk)); n > size {
+			t.Fatalf("chunk %d takes %d UTF-16 units, limit %d", i, n, size)
+		}
+		fences := 0
+		for _, line := range strings.Split(chunk, "\n") {
+			switch {
+			case strings.HasPrefix(line, "```"):
+				fences++
+			case strings.HasPrefix(line, "fmt."):
+				got = append(got, line)
+			}
+		}
+		if fences%2 != 0 {
+			t.Fatalf("chunk %d leaves a code block open:\n%s", i, chunk)
+		}
+		if i > 0 && i < len(chunks)-1 && !strings.HasPrefix(chunk, "```go\n") {
+			t.Fatalf("chunk %d does not reopen the code block:\n%s", i, chunk)
+		}
+	}
+	if strings.Join(got, "\n") != strings.Join(code, "\n") {
+		t.Fatal("code lines were lost or changed across chunks")
+	}
+	if last := chunks[len(chunks)-1]; !strings.HasSuffix(last, "Done.") {
+		t.Fatalf("last chunk = %q, want the text after the block", last)
+	}
+}
+
+func TestSplitMarkdownAstralRunes(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		size int
+	}{
+		{"odd size", strings.Repeat("😀", 9), 5},
+		{"mixed widths", strings.Repeat("a😀", 50), 7},
+		{"message limit", strings.Repeat("😀", messageLimit), messageLimit},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunks := splitMarkdown(tt.text, tt.size)
+			for i, chunk := range chunks {
+				if n := utf16Len([]rune(chunk)); n > tt.size {
+					t.Fatalf("chunk %d takes %d UTF-16 units, limit %d", i, n, tt.size)
+				}
+				if !utf8.ValidString(chunk) || strings.ContainsRune(chunk, utf8.RuneError) {
+					t.Fatalf("chunk %d splits a rune: %q", i, chunk)
+				}
+			}
+			if got := strings.Join(chunks, ""); got != tt.text {
+				t.Fatalf("chunks joined = %q, want the original text", got)
+			}
+		})
+	}
+}
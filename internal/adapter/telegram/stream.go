@@ -0,0 +1,159 @@
+package telegram
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	streamPlaceholder  = "…"
+	streamEmptyMessage = "(empty response)"
+)
+
+// streamWriter renders a streamed reply into Telegram messages. It edits the
+// current message at most once per interval and starts a new message once the
+// text passes messageLimit. The message being written carries markup,
+// typically a stop button, until the reply is finished.
+type streamWriter struct {
+	bot      *Bot
+	chatID   int64
+	replyTo  int
+	interval time.Duration
+	markup   *tgbotapi.InlineKeyboardMarkup
+	// onRollover is called when the reply continues in a new message.
+	onRollover func(prevID, messageID int)
+
+	messageID int
+	prevID    int
+	sent      string
+	current   []rune
+	text      strings.Builder
+	lastEdit  time.Time
+	received  bool
+}
+
+func (b *Bot) newStreamWriter(chatID int64, replyTo int, markup *tgbotapi.InlineKeyboardMarkup) (*streamWriter, error) {
+	w := &streamWriter{
+		bot:      b,
+		chatID:   chatID,
+		replyTo:  replyTo,
+		interval: b.cfg.StreamEditInterval,
+		markup:   markup,
+	}
+	if err := w.post(streamPlaceholder); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *streamWriter) Write(delta string) error {
+	w.received = true
+	w.text.WriteString(delta)
+	w.current = append(w.current, []rune(delta)...)
+
+	for utf16Len(w.current) > messageLimit {
+		head, rest := cutMarkdown(string(w.current), messageLimit)
+		w.current = []rune(rest)
+		if head != w.sent || w.markup != nil {
+			w.editMessage(head, nil)
+		}
+		w.prevID = w.messageID
+		if err := w.post(string(w.current)); err != nil {
+			return err
+		}
+		if w.onRollover != nil {
+			w.onRollover(w.prevID, w.messageID)
+		}
+	}
+
+	if w.bot.now().Sub(w.lastEdit) >= w.interval {
+		w.edit(string(w.current))
+	}
+	return nil
+}
+
+// Text returns everything written so far.
+func (w *streamWriter) Text() string {
+	return w.text.String()
+}
+
+// Finish flushes the remaining text, replaces the streaming markup with markup
+// and returns the ID of the message that ends the reply.
+func (w *streamWriter) Finish(markup *tgbotapi.InlineKeyboardMarkup) int {
+	text := string(w.current)
+	if strings.TrimSpace(text) == "" {
+		if w.received && w.prevID != 0 {
+			// the reply ended exactly on a rollover; drop the trailing placeholder
+			if _, err := w.bot.api.Request(tgbotapi.NewDeleteMessage(w.chatID, w.messageID)); err != nil {
+				log.Printf("failed to delete placeholder: %v", err)
+			}
+			if markup != nil {
+				edit := tgbotapi.NewEditMessageReplyMarkup(w.chatID, w.prevID, *markup)
+				if _, err := w.bot.api.Send(edit); err != nil {
+					log.Printf("failed to attach reply buttons: %v", err)
+				}
+			}
+			return w.prevID
+		}
+		text = streamEmptyMessage
+	}
+	if text != w.sent || markup != nil || w.markup != nil {
+		w.editMessage(text, markup)
+	}
+	return w.messageID
+}
+
+// Fail reports err text in place of the placeholder, or as a follow-up when
+// part of the reply has already been shown.
+func (w *streamWriter) Fail(text string) {
+	if !w.received {
+		w.editMessage(text, nil)
+		return
+	}
+	w.Finish(nil)
+	w.bot.sendText(w.chatID, w.replyTo, text)
+}
+
+func (w *streamWriter) post(text string) error {
+	if strings.TrimSpace(text) == "" {
+		text = streamPlaceholder
+	}
+	msg := tgbotapi.NewMessage(w.chatID, text)
+	if w.messageID == 0 {
+		msg.ReplyToMessageID = w.replyTo
+	}
+	if w.markup != nil {
+		msg.ReplyMarkup = w.markup
+	}
+	sent, err := w.bot.sendFormatted(msg)
+	if err != nil {
+		return err
+	}
+	w.messageID = sent.MessageID
+	w.sent = text
+	w.lastEdit = w.bot.now()
+	return nil
+}
+
+func (w *streamWriter) edit(text string) {
+	if strings.TrimSpace(text) == "" || text == w.sent {
+		return
+	}
+	w.editMessage(text, w.markup)
+}
+
+// editMessage replaces the current message; without markup any buttons on
+// it are removed.
+func (w *streamWriter) editMessage(text string, markup *tgbotapi.InlineKeyboardMarkup) {
+	edit := tgbotapi.NewEditMessageText(w.chatID, w.messageID, text)
+	edit.ReplyMarkup = markup
+	if err := w.bot.editFormatted(edit); err != nil {
+		log.Printf("failed to edit streamed reply: %v", err)
+		return
+	}
+	w.sent = text
+	w.lastEdit = w.bot.now()
+}
@@ -0,0 +1,51 @@
+package telegram
+
+import (
+	"fmt"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"chatgpt-telegram-bot/internal/domain"
+)
+
+func (b *Bot) handleUsage(msg *tgbotapi.Message) {
+	report := b.usage.UserReport(msg.From.ID)
+
+	var sb strings.Builder
+	sb.WriteString("your usage\n\ntoday:\n")
+	writeTotals(&sb, report.Today)
+	sb.WriteString("\nthis month:\n")
+	writeTotals(&sb, report.Month)
+	b.sendText(msg.Chat.ID, msg.MessageID, sb.String())
+}
+
+func (b *Bot) handleStats(msg *tgbotapi.Message) {
+	if !isAdmin(msg.From.ID, b.cfg) {
+		b.sendText(msg.Chat.ID, msg.MessageID, "this command is for admins only")
+		return
+	}
+
+	report, top := b.usage.GlobalReport()
+
+	var sb strings.Builder
+	sb.WriteString("bot usage\n\ntoday:\n")
+	writeTotals(&sb, report.Today)
+	sb.WriteString("\nthis month:\n")
+	writeTotals(&sb, report.Month)
+	if len(top) > 0 {
+		sb.WriteString("\ntop users this month:\n")
+		for _, u := range top {
+			fmt.Fprintf(&sb, "%d: %d requests, $%.4f\n", u.UserID, u.Requests, u.Cost)
+		}
+	}
+	b.sendText(msg.Chat.ID, msg.MessageID, sb.String())
+}
+
+func writeTotals(sb *strings.Builder, t domain.UsageTotals) {
+	fmt.Fprintf(sb, "requests: %d\n", t.Requests)
+	fmt.Fprintf(sb, "tokens: %d prompt, %d completion\n", t.PromptTokens, t.CompletionTokens)
+	fmt.Fprintf(sb, "tts characters: %d\n", t.TTSChars)
+	fmt.Fprintf(sb, "images: %d\n", t.Images)
+	fmt.Fprintf(sb, "cost: $%.4f\n", t.Cost)
+}
@@ -0,0 +1,95 @@
+package telegram
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const secretTokenHeader = "X-Telegram-Bot-Api-Secret-Token"
+
+func (b *Bot) runWebhook(ctx, workCtx context.Context) error {
+	hook, err := url.Parse(b.cfg.WebhookURL)
+	if err != nil {
+		return fmt.Errorf("parse webhook url: %w", err)
+	}
+	path := hook.Path
+	if path == "" {
+		path = "/"
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		b.serveUpdate(workCtx, w, r)
+	})
+	srv := &http.Server{
+		Addr:              b.cfg.WebhookListen,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- srv.ListenAndServe()
+	}()
+
+	if err := b.registerWebhook(); err != nil {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), b.cfg.ShutdownTimeout)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+		return fmt.Errorf("register webhook: %w", err)
+	}
+	log.Printf("webhook server listening on %s%s", b.cfg.WebhookListen, path)
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), b.cfg.ShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Printf("webhook server shutdown: %v", err)
+	}
+	return ctx.Err()
+}
+
+func (b *Bot) serveUpdate(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	if secret := b.cfg.WebhookSecret; secret != "" {
+		got := r.Header.Get(secretTokenHeader)
+		if subtle.ConstantTimeCompare([]byte(got), []byte(secret)) != 1 {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+	}
+
+	update, err := b.api.HandleUpdate(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := b.dispatch(r.Context(), ctx, *update); err != nil {
+		// telegram redelivers updates that were not acknowledged
+		http.Error(w, "busy", http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// registerWebhook calls setWebhook directly because WebhookConfig in the
+// library has no secret_token field.
+func (b *Bot) registerWebhook() error {
+	params := tgbotapi.Params{"url": b.cfg.WebhookURL}
+	params.AddNonEmpty("secret_token", b.cfg.WebhookSecret)
+	_, err := b.api.MakeRequest("setWebhook", params)
+	return err
+}
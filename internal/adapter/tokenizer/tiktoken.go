@@ -0,0 +1,55 @@
+package tokenizer
+
+import (
+	"log"
+	"sync"
+
+	"github.com/pkoukk/tiktoken-go"
+	tiktokenloader "github.com/pkoukk/tiktoken-go-loader"
+)
+
+// defaultEncoding is used for models tiktoken does not know yet.
+const defaultEncoding = "o200k_base"
+
+type Tiktoken struct {
+	mu        sync.Mutex
+	encodings map[string]*tiktoken.Tiktoken
+}
+
+func NewTiktoken() *Tiktoken {
+	// bundled BPE ranks, so counting works without network access
+	tiktoken.SetBpeLoader(tiktokenloader.NewOfflineLoader())
+	return &Tiktoken{
+		encodings: make(map[string]*tiktoken.Tiktoken),
+	}
+}
+
+func (t *Tiktoken) Count(model, text string) int {
+	if text == "" {
+		return 0
+	}
+	enc := t.encoding(model)
+	if enc == nil {
+		return (len([]rune(text)) + 3) / 4
+	}
+	return len(enc.Encode(text, nil, nil))
+}
+
+func (t *Tiktoken) encoding(model string) *tiktoken.Tiktoken {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if enc, ok := t.encodings[model]; ok {
+		return enc
+	}
+
+	enc, err := tiktoken.EncodingForModel(model)
+	if err != nil {
+		enc, err = tiktoken.GetEncoding(defaultEncoding)
+	}
+	if err != nil {
+		log.Printf("tokenizer unavailable for %s: %v", model, err)
+	}
+	t.encodings[model] = enc
+	return enc
+}
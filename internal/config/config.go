@@ -2,33 +2,132 @@ package config
 
 import (
 	"bufio"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"log"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 )
 
+const defaultOpenAIBaseURL = "https://api.openai.com/v1"
+
+// DefaultContextWindow is the context size assumed for models without a
+// configured window.
+const DefaultContextWindow = 128000
+
 type Config struct {
-	OpenAIKey           string
-	TelegramToken       string
-	Model               string
-	AdminUserIDs        []int64
-	AllowedUserIDs      []int64
-	AllowedChatIDs      []int64
-	TTSModel            string
-	TTSVoice            string
-	TTSFormat           string
-	ImageModel          string
-	ImageSize           string
-	ImageQuality        string
-	ImageFormat         string
-	ImageBackground     string
-	AssistantPrompt     string
-	MaxCompletionTokens int
-	ContextLimit        int
-	ContextTTL          time.Duration
+	OpenAIKey             string
+	OpenAIBaseURL         string
+	OpenAIAPIType         string
+	OpenAIAPIVersion      string
+	OpenAIOrgID           string
+	OpenAIProject         string
+	OpenAITimeout         time.Duration
+	AnthropicKey          string
+	AnthropicBaseURL      string
+	AnthropicVersion      string
+	AnthropicTimeout      time.Duration
+	TelegramToken         string
+	TelegramMode          string
+	WebhookURL            string
+	WebhookListen         string
+	WebhookSecret         string
+	ShutdownTimeout       time.Duration
+	Workers               int
+	WorkerQueueSize       int
+	Model                 string
+	Models                []string
+	AdminUserIDs          []int64
+	AllowedUserIDs        []int64
+	AllowedChatIDs        []int64
+	GroupReplyMode        string
+	GroupContext          string
+	TTSModel              string
+	TTSVoice              string
+	TTSFormat             string
+	ImageModel            string
+	ImageSize             string
+	ImageQuality          string
+	ImageFormat           string
+	ImageBackground       string
+	AssistantPrompt       string
+	Personas              []Persona
+	Prices                map[string]ModelPrice
+	MaxCompletionTokens   int
+	ToolsEnabled          bool
+	ToolMaxIterations     int
+	ContextLimit          int
+	ContextTTL            time.Duration
+	ContextWindow         int
+	SummaryModel          string
+	SummaryTrigger        int
+	SummaryMaxTokens      int
+	ModelContextWindows   map[string]int
+	StoreDriver           string
+	StoreDSN              string
+	ContextChatCap        int
+	StoreMaxMessages      int
+	JanitorInterval       time.Duration
+	StreamReplies         bool
+	StreamEditInterval    time.Duration
+	ReplyFileThreshold    int
+	TranscribeModel       string
+	TranscribeLanguage    string
+	TranscribeMaxDuration time.Duration
+	DownloadMaxBytes      int64
+	DocumentMaxBytes      int64
+	DocumentMaxChars      int
+	UserRatePerMinute     int
+	UserRateBurst         int
+	ChatRatePerMinute     int
+	ChatRateBurst         int
+	DailyRequestLimit     int
+	DailyImageLimit       int
+	DailyTTSCharLimit     int
+	MaxRetries            int
+	RetryBaseDelay        time.Duration
+	RetryMaxDelay         time.Duration
+	Routing               Routing
+	BreakerFailures       int
+	BreakerCooldown       time.Duration
+}
+
+// Persona is a named prompt with an optional model and temperature; a nil
+// Temperature keeps the model's default.
+type Persona struct {
+	Name        string   `json:"name"`
+	Prompt      string   `json:"prompt"`
+	Model       string   `json:"model"`
+	Temperature *float32 `json:"temperature"`
+}
+
+// Routing sends chat requests to other models: Rules pick a model for a
+// request, Fallbacks list the models tried in order when a model's provider
+// fails.
+type Routing struct {
+	Rules     []RouteRule         `json:"rules"`
+	Fallbacks map[string][]string `json:"fallbacks"`
+}
+
+// RouteRule switches a request to Model when all of its conditions hold.
+// Models limits the rule to requests for those models; empty means any.
+type RouteRule struct {
+	Models          []string `json:"models"`
+	Images          bool     `json:"images"`
+	MinPromptTokens int      `json:"min_prompt_tokens"`
+	Model           string   `json:"model"`
+}
+
+// ModelPrice is the price of a model in USD; unset fields cost nothing.
+type ModelPrice struct {
+	InputPer1M  float64 `json:"input_per_1m"`
+	OutputPer1M float64 `json:"output_per_1m"`
+	CharsPer1M  float64 `json:"chars_per_1m"`
+	PerImage    float64 `json:"per_image"`
 }
 
 func Load(path string) (Config, error) {
@@ -37,26 +136,117 @@ func Load(path string) (Config, error) {
 	}
 
 	cfg := Config{
-		Model:               getenvDefault("OPENAI_MODEL", "gpt-5.1"),
-		TTSModel:            getenvDefault("OPENAI_TTS_MODEL", "gpt-4o-mini-tts"),
-		TTSVoice:            getenvDefault("OPENAI_TTS_VOICE", "alloy"),
-		TTSFormat:           getenvDefault("OPENAI_TTS_FORMAT", "opus"),
-		ImageModel:          getenvDefault("OPENAI_IMAGE_MODEL", ""),
-		ImageSize:           getenvDefault("OPENAI_IMAGE_SIZE", "auto"),
-		ImageQuality:        getenvDefault("OPENAI_IMAGE_QUALITY", "auto"),
-		ImageFormat:         getenvDefault("OPENAI_IMAGE_FORMAT", "png"),
-		ImageBackground:     getenvDefault("OPENAI_IMAGE_BACKGROUND", ""),
-		AssistantPrompt:     getenvDefault("ASSISTANT_PROMPT", "You are telegram bot assistant"),
-		MaxCompletionTokens: getenvIntDefault("MAX_TOKENS", 4096),
-		ContextLimit:        getenvIntDefault("CONTEXT_MESSAGE_LIMIT", 20),
-		ContextTTL:          time.Duration(getenvIntDefault("CONTEXT_TTL_MINUTES", 120)) * time.Minute,
+		OpenAIBaseURL:         strings.TrimRight(os.Getenv("OPENAI_BASE_URL"), "/"),
+		OpenAIAPIType:         strings.ToLower(getenvDefault("OPENAI_API_TYPE", "openai")),
+		OpenAIAPIVersion:      getenvDefault("OPENAI_API_VERSION", "2025-04-01-preview"),
+		OpenAIOrgID:           os.Getenv("OPENAI_ORG_ID"),
+		OpenAIProject:         os.Getenv("OPENAI_PROJECT_ID"),
+		OpenAITimeout:         time.Duration(getenvIntDefault("OPENAI_TIMEOUT_SEC", 300)) * time.Second,
+		AnthropicBaseURL:      strings.TrimRight(getenvDefault("ANTHROPIC_BASE_URL", "https://api.anthropic.com"), "/"),
+		AnthropicVersion:      getenvDefault("ANTHROPIC_VERSION", "2023-06-01"),
+		AnthropicTimeout:      time.Duration(getenvIntDefault("ANTHROPIC_TIMEOUT_SEC", 300)) * time.Second,
+		TelegramMode:          strings.ToLower(getenvDefault("TELEGRAM_MODE", "polling")),
+		WebhookURL:            os.Getenv("WEBHOOK_URL"),
+		WebhookListen:         getenvDefault("WEBHOOK_LISTEN", ":8080"),
+		WebhookSecret:         os.Getenv("WEBHOOK_SECRET"),
+		GroupReplyMode:        strings.ToLower(getenvDefault("GROUP_REPLY_MODE", "mention")),
+		GroupContext:          strings.ToLower(getenvDefault("GROUP_CONTEXT", "shared")),
+		ShutdownTimeout:       time.Duration(getenvIntDefault("SHUTDOWN_TIMEOUT_SEC", 30)) * time.Second,
+		Workers:               getenvIntDefault("WORKERS", 8),
+		WorkerQueueSize:       getenvIntDefault("WORKER_QUEUE_SIZE", 64),
+		Model:                 getenvDefault("OPENAI_MODEL", "gpt-5.1"),
+		TTSModel:              getenvDefault("OPENAI_TTS_MODEL", "gpt-4o-mini-tts"),
+		TTSVoice:              getenvDefault("OPENAI_TTS_VOICE", "alloy"),
+		TTSFormat:             getenvDefault("OPENAI_TTS_FORMAT", "opus"),
+		ImageModel:            getenvDefault("OPENAI_IMAGE_MODEL", ""),
+		ImageSize:             getenvDefault("OPENAI_IMAGE_SIZE", "auto"),
+		ImageQuality:          getenvDefault("OPENAI_IMAGE_QUALITY", "auto"),
+		ImageFormat:           getenvDefault("OPENAI_IMAGE_FORMAT", "png"),
+		ImageBackground:       getenvDefault("OPENAI_IMAGE_BACKGROUND", ""),
+		AssistantPrompt:       getenvDefault("ASSISTANT_PROMPT", "You are telegram bot assistant"),
+		MaxCompletionTokens:   getenvIntDefault("MAX_TOKENS", 4096),
+		ToolsEnabled:          getenvBoolDefault("TOOLS_ENABLED", true),
+		ToolMaxIterations:     getenvIntDefault("TOOL_MAX_ITERATIONS", 5),
+		ContextLimit:          getenvIntDefault("CONTEXT_MESSAGE_LIMIT", 20),
+		ContextTTL:            time.Duration(getenvIntDefault("CONTEXT_TTL_MINUTES", 120)) * time.Minute,
+		ContextWindow:         getenvIntDefault("CONTEXT_WINDOW_TOKENS", DefaultContextWindow),
+		SummaryModel:          os.Getenv("SUMMARY_MODEL"),
+		SummaryTrigger:        getenvIntDefault("SUMMARY_TRIGGER_MESSAGES", 10),
+		SummaryMaxTokens:      getenvIntDefault("SUMMARY_MAX_TOKENS", 1024),
+		StoreDriver:           strings.ToLower(getenvDefault("STORE_DRIVER", "memory")),
+		StoreDSN:              getenvDefault("STORE_DSN", "bot.db"),
+		ContextChatCap:        getenvIntDefault("CONTEXT_CHAT_MESSAGE_CAP", 200),
+		StoreMaxMessages:      getenvIntDefault("STORE_MAX_MESSAGES", 100000),
+		JanitorInterval:       time.Duration(getenvIntDefault("STORE_JANITOR_INTERVAL_MINUTES", 5)) * time.Minute,
+		StreamReplies:         getenvBoolDefault("STREAM_REPLIES", true),
+		StreamEditInterval:    time.Duration(getenvIntDefault("STREAM_EDIT_INTERVAL_MS", 1000)) * time.Millisecond,
+		ReplyFileThreshold:    getenvIntDefault("REPLY_FILE_THRESHOLD", 12000),
+		TranscribeModel:       getenvDefault("OPENAI_TRANSCRIBE_MODEL", "whisper-1"),
+		TranscribeLanguage:    getenvDefault("TRANSCRIBE_LANGUAGE", ""),
+		TranscribeMaxDuration: time.Duration(getenvIntDefault("TRANSCRIBE_MAX_DURATION_SEC", 600)) * time.Second,
+		DownloadMaxBytes:      int64(getenvIntDefault("DOWNLOAD_MAX_BYTES", 20<<20)),
+		DocumentMaxBytes:      int64(getenvIntDefault("DOCUMENT_MAX_BYTES", 5<<20)),
+		DocumentMaxChars:      getenvIntDefault("DOCUMENT_MAX_CHARS", 20000),
+		UserRatePerMinute:     getenvIntDefault("RATE_LIMIT_USER_PER_MINUTE", 20),
+		UserRateBurst:         getenvIntDefault("RATE_LIMIT_USER_BURST", 5),
+		ChatRatePerMinute:     getenvIntDefault("RATE_LIMIT_CHAT_PER_MINUTE", 60),
+		ChatRateBurst:         getenvIntDefault("RATE_LIMIT_CHAT_BURST", 10),
+		DailyRequestLimit:     getenvIntDefault("DAILY_REQUEST_LIMIT", 0),
+		DailyImageLimit:       getenvIntDefault("DAILY_IMAGE_LIMIT", 0),
+		DailyTTSCharLimit:     getenvIntDefault("DAILY_TTS_CHAR_LIMIT", 0),
+		BreakerFailures:       getenvIntDefault("BREAKER_FAILURES", 3),
+		BreakerCooldown:       time.Duration(getenvIntDefault("BREAKER_COOLDOWN_SEC", 30)) * time.Second,
+		MaxRetries:            getenvIntDefault("MAX_RETRIES", 3),
+		RetryBaseDelay:        time.Duration(getenvIntDefault("RETRY_BASE_DELAY_MS", 500)) * time.Millisecond,
+		RetryMaxDelay:         time.Duration(getenvIntDefault("RETRY_MAX_DELAY_MS", 20000)) * time.Millisecond,
 	}
 
 	cfg.OpenAIKey = os.Getenv("OPENAI_API_KEY")
+	cfg.AnthropicKey = os.Getenv("ANTHROPIC_API_KEY")
 	cfg.TelegramToken = os.Getenv("TELEGRAM_BOT_TOKEN")
-	if cfg.OpenAIKey == "" || cfg.TelegramToken == "" {
-		return cfg, errors.New("openai api key and telegram token are required")
+	if cfg.TelegramToken == "" {
+		return cfg, errors.New("telegram token is required")
+	}
+	switch cfg.OpenAIAPIType {
+	case "openai":
+		// self-hosted OpenAI-compatible servers often run without a key
+		if cfg.OpenAIBaseURL == "" {
+			cfg.OpenAIBaseURL = defaultOpenAIBaseURL
+		}
+		if cfg.OpenAIKey == "" && cfg.OpenAIBaseURL == defaultOpenAIBaseURL {
+			return cfg, errors.New("openai api key is required")
+		}
+	case "azure":
+		if cfg.OpenAIKey == "" || cfg.OpenAIBaseURL == "" {
+			return cfg, errors.New("azure mode requires OPENAI_API_KEY and OPENAI_BASE_URL")
+		}
+	default:
+		return cfg, fmt.Errorf("unknown openai api type %q", cfg.OpenAIAPIType)
+	}
+
+	cfg.ModelContextWindows = parseIntMap("MODEL_CONTEXT_WINDOWS")
+	cfg.Models = parseList(os.Getenv("OPENAI_MODELS"))
+	if !slices.Contains(cfg.Models, cfg.Model) {
+		cfg.Models = append([]string{cfg.Model}, cfg.Models...)
+	}
+
+	personas, err := loadPersonas(os.Getenv("PERSONAS_FILE"), cfg.Models)
+	if err != nil {
+		return cfg, fmt.Errorf("load personas: %w", err)
+	}
+	cfg.Personas = personas
+
+	prices, err := loadPrices(os.Getenv("PRICES_FILE"))
+	if err != nil {
+		return cfg, fmt.Errorf("load prices: %w", err)
+	}
+	cfg.Prices = prices
+
+	routing, err := loadRouting(os.Getenv("ROUTING_FILE"))
+	if err != nil {
+		return cfg, fmt.Errorf("load routing: %w", err)
 	}
+	cfg.Routing = routing
 
 	cfg.AdminUserIDs = parseIDs(os.Getenv("ADMIN_USER_IDS"))
 	cfg.AllowedUserIDs = parseIDs(os.Getenv("ALLOWED_TELEGRAM_USER_IDS"))
@@ -64,10 +254,97 @@ func Load(path string) (Config, error) {
 	if cfg.ImageModel == "" {
 		cfg.ImageModel = cfg.Model
 	}
+	switch cfg.TelegramMode {
+	case "polling":
+	case "webhook":
+		if cfg.WebhookURL == "" {
+			return cfg, errors.New("webhook mode requires WEBHOOK_URL")
+		}
+	default:
+		return cfg, fmt.Errorf("unknown telegram mode %q", cfg.TelegramMode)
+	}
+	if cfg.GroupReplyMode != "mention" && cfg.GroupReplyMode != "all" {
+		return cfg, fmt.Errorf("unknown group reply mode %q", cfg.GroupReplyMode)
+	}
+	if cfg.GroupContext != "shared" && cfg.GroupContext != "user" {
+		return cfg, fmt.Errorf("unknown group context %q", cfg.GroupContext)
+	}
+	if cfg.StoreDriver != "memory" && cfg.StoreDriver != "sqlite" {
+		return cfg, fmt.Errorf("unknown store driver %q", cfg.StoreDriver)
+	}
 
 	return cfg, nil
 }
 
+func loadPersonas(path string, models []string) ([]Persona, error) {
+	path = strings.TrimSpace(path)
+	if path == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var personas []Persona
+	if err := json.Unmarshal(data, &personas); err != nil {
+		return nil, err
+	}
+	for i, p := range personas {
+		if strings.TrimSpace(p.Name) == "" || strings.TrimSpace(p.Prompt) == "" {
+			return nil, fmt.Errorf("persona #%d needs a name and a prompt", i+1)
+		}
+		// personas must not bypass the models /model allows
+		if p.Model != "" && !slices.Contains(models, p.Model) {
+			return nil, fmt.Errorf("persona %q uses model %q, which is not in OPENAI_MODELS", p.Name, p.Model)
+		}
+		personas[i].Name = strings.ToLower(strings.TrimSpace(p.Name))
+	}
+	return personas, nil
+}
+
+func loadPrices(path string) (map[string]ModelPrice, error) {
+	path = strings.TrimSpace(path)
+	if path == "" {
+		return map[string]ModelPrice{}, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	prices := make(map[string]ModelPrice)
+	if err := json.Unmarshal(data, &prices); err != nil {
+		return nil, err
+	}
+	return prices, nil
+}
+
+func loadRouting(path string) (Routing, error) {
+	path = strings.TrimSpace(path)
+	if path == "" {
+		return Routing{}, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Routing{}, err
+	}
+
+	var routing Routing
+	if err := json.Unmarshal(data, &routing); err != nil {
+		return Routing{}, err
+	}
+	for i, r := range routing.Rules {
+		if strings.TrimSpace(r.Model) == "" || (!r.Images && r.MinPromptTokens <= 0) {
+			return Routing{}, fmt.Errorf("rule #%d needs a model and a condition", i+1)
+		}
+	}
+	return routing, nil
+}
+
 func parseIDs(raw string) []int64 {
 	raw = strings.TrimSpace(raw)
 	if raw == "" {
@@ -91,6 +368,38 @@ func parseIDs(raw string) []int64 {
 	return ids
 }
 
+func parseList(raw string) []string {
+	parts := strings.Split(raw, ",")
+	res := make([]string, 0, len(parts))
+	for _, p := range parts {
+		p = strings.TrimSpace(p)
+		if p != "" {
+			res = append(res, p)
+		}
+	}
+	return res
+}
+
+// parseIntMap reads "name=value,name=value" pairs from the key variable.
+func parseIntMap(key string) map[string]int {
+	res := make(map[string]int)
+	for _, pair := range parseList(os.Getenv(key)) {
+		name, raw, ok := strings.Cut(pair, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			log.Printf("skipping %s entry %q: expected name=value", key, pair)
+			continue
+		}
+		v, err := strconv.Atoi(strings.TrimSpace(raw))
+		if err != nil {
+			log.Printf("skipping %s entry %q: %v", key, pair, err)
+			continue
+		}
+		res[name] = v
+	}
+	return res
+}
+
 func getenvDefault(key, def string) string {
 	v := os.Getenv(key)
 	if v == "" {
@@ -112,6 +421,19 @@ func getenvIntDefault(key string, def int) int {
 	return n
 }
 
+func getenvBoolDefault(key string, def bool) bool {
+	v := strings.TrimSpace(os.Getenv(key))
+	if v == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		log.Printf("invalid bool for %s=%q, using default %t", key, v, def)
+		return def
+	}
+	return b
+}
+
 func loadDotEnv(path string) error {
 	file, err := os.Open(path)
 	if err != nil {
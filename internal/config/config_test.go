@@ -0,0 +1,40 @@
+package config
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadTrimsBaseURLs(t *testing.T) {
+	tests := []struct {
+		name          string
+		openAI        string
+		anthropic     string
+		wantOpenAI    string
+		wantAnthropic string
+	}{
+		{"defaults", "", "", defaultOpenAIBaseURL, "https://api.anthropic.com"},
+		{"no trailing slash", "http://localhost:8000/v1", "http://proxy", "http://localhost:8000/v1", "http://proxy"},
+		{"trailing slash", "http://localhost:8000/v1/", "http://proxy/", "http://localhost:8000/v1", "http://proxy"},
+		{"default with trailing slash", defaultOpenAIBaseURL + "/", "", defaultOpenAIBaseURL, "https://api.anthropic.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TELEGRAM_BOT_TOKEN", "test-token")
+			t.Setenv("OPENAI_API_KEY", "test-key")
+			t.Setenv("OPENAI_BASE_URL", tt.openAI)
+			t.Setenv("ANTHROPIC_BASE_URL", tt.anthropic)
+
+			cfg, err := Load(filepath.Join(t.TempDir(), ".env"))
+			if err != nil {
+				t.Fatalf("Load() error: %v", err)
+			}
+			if cfg.OpenAIBaseURL != tt.wantOpenAI {
+				t.Errorf("OpenAIBaseURL = %q, want %q", cfg.OpenAIBaseURL, tt.wantOpenAI)
+			}
+			if cfg.AnthropicBaseURL != tt.wantAnthropic {
+				t.Errorf("AnthropicBaseURL = %q, want %q", cfg.AnthropicBaseURL, tt.wantAnthropic)
+			}
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrRateLimited   = errors.New("rate limited by provider")
+	ErrContentPolicy = errors.New("rejected by content policy")
+	ErrUnauthorized  = errors.New("provider rejected credentials")
+	ErrTimeout       = errors.New("provider timed out")
+	ErrUnavailable   = errors.New("provider unavailable")
+)
+
+// ProviderError is a failed call to a model provider, classified so callers
+// can decide whether to retry and what to tell the user. Kind is one of the
+// errors above or another sentinel such as chat.ErrContextTooLong.
+type ProviderError struct {
+	Kind       error
+	Retryable  bool
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (e *ProviderError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ProviderError) Unwrap() []error {
+	return []error{e.Kind, e.Err}
+}
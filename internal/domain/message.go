@@ -6,10 +6,23 @@ const (
 	RoleSystem    = "system"
 	RoleUser      = "user"
 	RoleAssistant = "assistant"
+	RoleTool      = "tool"
 )
 
 type Message struct {
 	Role      string
 	Content   string
 	Timestamp time.Time
+	// MessageID is the Telegram message holding the turn and ParentID the
+	// turn it follows; replies to older messages branch off through them.
+	// Zero when unknown.
+	MessageID int
+	ParentID  int
+}
+
+// Summary condenses the turns of a conversation up to and including Until.
+type Summary struct {
+	Content   string
+	Until     time.Time
+	UpdatedAt time.Time
 }
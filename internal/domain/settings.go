@@ -0,0 +1,16 @@
+package domain
+
+type ChatSettings struct {
+	Model        string
+	Persona      string
+	SystemPrompt string
+	// GroupReplyMode and GroupContext override the configured group policy;
+	// empty means the default.
+	GroupReplyMode string
+	GroupContext   string
+}
+
+type SettingsStore interface {
+	Settings(chatID int64) ChatSettings
+	SaveSettings(chatID int64, settings ChatSettings)
+}
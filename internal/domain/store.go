@@ -5,4 +5,16 @@ import "time"
 type ConversationStore interface {
 	Add(chatID int64, msg Message)
 	FreshMessages(chatID int64, limit int, ttl time.Duration) []Message
+	List(chatID int64, limit int) []Message
+	// Thread follows parent links back from messageID and returns up to limit
+	// fresh messages of that reply chain, oldest first.
+	Thread(chatID int64, messageID int, limit int, ttl time.Duration) []Message
+	// SetReplyID records messageID on the latest assistant turn that follows
+	// parentID and has no message ID yet.
+	SetReplyID(chatID int64, parentID, messageID int)
+	// DeleteLast removes the n most recent messages of a chat.
+	DeleteLast(chatID int64, n int)
+	Clear(chatID int64)
+	Summary(chatID int64) Summary
+	SaveSummary(chatID int64, summary Summary)
 }
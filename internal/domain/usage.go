@@ -0,0 +1,50 @@
+package domain
+
+import "time"
+
+const (
+	UsageChat  = "chat"
+	UsageTTS   = "tts"
+	UsageImage = "image"
+)
+
+// UsageRecord is one billed request.
+type UsageRecord struct {
+	UserID           int64
+	ChatID           int64
+	Kind             string
+	Model            string
+	PromptTokens     int
+	CompletionTokens int
+	TTSChars         int
+	Images           int
+	Cost             float64
+	Timestamp        time.Time
+}
+
+type UsageTotals struct {
+	Requests         int
+	PromptTokens     int
+	CompletionTokens int
+	TTSChars         int
+	Images           int
+	Cost             float64
+}
+
+type UserUsage struct {
+	UserID int64
+	UsageTotals
+}
+
+// UsageFilter narrows totals to a user and/or chat; zero values match all.
+type UsageFilter struct {
+	UserID int64
+	ChatID int64
+	Since  time.Time
+}
+
+type UsageLedger interface {
+	Record(rec UsageRecord)
+	Totals(filter UsageFilter) UsageTotals
+	TopUsers(since time.Time, limit int) []UserUsage
+}
@@ -0,0 +1,189 @@
+package extract
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ledongthuc/pdf"
+)
+
+var (
+	ErrUnsupported = errors.New("unsupported document type")
+	ErrEmpty       = errors.New("document has no text")
+)
+
+type Kind string
+
+const (
+	KindText Kind = "text"
+	KindJSON Kind = "json"
+	KindCSV  Kind = "csv"
+	KindPDF  Kind = "pdf"
+)
+
+type Result struct {
+	Kind      Kind
+	Text      string
+	Truncated bool
+}
+
+var textExtensions = map[string]bool{
+	".txt": true, ".md": true, ".markdown": true, ".rst": true, ".log": true,
+	".go": true, ".py": true, ".js": true, ".ts": true, ".tsx": true, ".jsx": true,
+	".java": true, ".kt": true, ".c": true, ".h": true, ".cpp": true, ".hpp": true,
+	".cs": true, ".rs": true, ".rb": true, ".php": true, ".swift": true, ".scala": true,
+	".sh": true, ".bash": true, ".zsh": true, ".ps1": true, ".sql": true,
+	".html": true, ".htm": true, ".css": true, ".scss": true, ".xml": true, ".svg": true,
+	".yaml": true, ".yml": true, ".toml": true, ".ini": true, ".cfg": true, ".conf": true,
+	".env": true, ".properties": true, ".tex": true, ".proto": true, ".graphql": true,
+	".mod": true, ".sum": true, ".dockerfile": true, ".makefile": true, ".tsv": true,
+}
+
+// Detect picks the extraction kind from the file name and declared MIME type.
+func Detect(name, mimeType string) (Kind, bool) {
+	ext := strings.ToLower(filepath.Ext(name))
+	if mimeType == "" {
+		mimeType = mime.TypeByExtension(ext)
+	}
+	mimeType = strings.ToLower(strings.TrimSpace(strings.SplitN(mimeType, ";", 2)[0]))
+
+	switch {
+	case ext == ".pdf" || mimeType == "application/pdf":
+		return KindPDF, true
+	case ext == ".json" || mimeType == "application/json":
+		return KindJSON, true
+	case ext == ".csv" || mimeType == "text/csv":
+		return KindCSV, true
+	case textExtensions[ext]:
+		return KindText, true
+	case strings.HasPrefix(mimeType, "text/"),
+		mimeType == "application/xml",
+		mimeType == "application/x-yaml",
+		mimeType == "application/yaml",
+		mimeType == "application/x-sh":
+		return KindText, true
+	}
+
+	switch strings.ToLower(filepath.Base(name)) {
+	case "dockerfile", "makefile", "license", "readme":
+		return KindText, true
+	}
+
+	return "", false
+}
+
+// Text extracts readable text from data, cutting it to maxChars runes when
+// maxChars is positive.
+func Text(name, mimeType string, data []byte, maxChars int) (Result, error) {
+	kind, ok := Detect(name, mimeType)
+	if !ok {
+		return Result{}, ErrUnsupported
+	}
+
+	var (
+		text string
+		err  error
+	)
+	switch kind {
+	case KindPDF:
+		text, err = pdfText(data)
+	case KindJSON:
+		text, err = jsonText(data)
+	case KindCSV:
+		text, err = csvText(data)
+	default:
+		text, err = plainText(data)
+	}
+	if err != nil {
+		return Result{}, err
+	}
+
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return Result{}, ErrEmpty
+	}
+
+	res := Result{Kind: kind, Text: text}
+	if maxChars > 0 && utf8.RuneCountInString(text) > maxChars {
+		res.Text = string([]rune(text)[:maxChars])
+		res.Truncated = true
+	}
+	return res, nil
+}
+
+func plainText(data []byte) (string, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	if !utf8.Valid(data) {
+		return "", fmt.Errorf("%w: not valid utf-8", ErrUnsupported)
+	}
+	return string(data), nil
+}
+
+func jsonText(data []byte) (string, error) {
+	text, err := plainText(data)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, []byte(text), "", "  "); err != nil {
+		// keep malformed json as-is, the model can still read it
+		return text, nil
+	}
+	return buf.String(), nil
+}
+
+func csvText(data []byte) (string, error) {
+	text, err := plainText(data)
+	if err != nil {
+		return "", err
+	}
+	r := csv.NewReader(strings.NewReader(text))
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+
+	var sb strings.Builder
+	for {
+		record, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			// fall back to the raw file when the csv does not parse
+			return text, nil
+		}
+		sb.WriteString(strings.Join(record, " | "))
+		sb.WriteByte('\n')
+	}
+	return sb.String(), nil
+}
+
+func pdfText(data []byte) (text string, err error) {
+	// the pdf reader panics on some malformed files
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("read pdf: %v", r)
+		}
+	}()
+
+	reader, err := pdf.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", fmt.Errorf("read pdf: %w", err)
+	}
+	plain, err := reader.GetPlainText()
+	if err != nil {
+		return "", fmt.Errorf("read pdf: %w", err)
+	}
+	raw, err := io.ReadAll(plain)
+	if err != nil {
+		return "", fmt.Errorf("read pdf: %w", err)
+	}
+	return string(raw), nil
+}
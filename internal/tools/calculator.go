@@ -0,0 +1,277 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"chatgpt-telegram-bot/internal/usecase/chat"
+)
+
+// Calculator evaluates arithmetic expressions so the model does not have to.
+func Calculator() chat.Tool {
+	return chat.Tool{
+		Definition: chat.ToolDefinition{
+			Name:        "calculator",
+			Description: "Evaluate an arithmetic expression. Supports + - * / % ^, parentheses, pi, e and sqrt, abs, ln, log, sin, cos, tan, floor, ceil, round.",
+			Parameters: json.RawMessage(`{
+				"type": "object",
+				"properties": {
+					"expression": {
+						"type": "string",
+						"description": "expression to evaluate, e.g. (2 + 3) * sqrt(16)"
+					}
+				},
+				"required": ["expression"]
+			}`),
+		},
+		Handler: func(_ context.Context, raw json.RawMessage) (string, error) {
+			var args struct {
+				Expression string `json:"expression"`
+			}
+			if err := json.Unmarshal(raw, &args); err != nil {
+				return "", err
+			}
+			v, err := Evaluate(args.Expression)
+			if err != nil {
+				return "", err
+			}
+			return strconv.FormatFloat(v, 'g', -1, 64), nil
+		},
+	}
+}
+
+var errSyntax = errors.New("invalid expression")
+
+var functions = map[string]func(float64) float64{
+	"sqrt":  math.Sqrt,
+	"abs":   math.Abs,
+	"ln":    math.Log,
+	"log":   math.Log10,
+	"sin":   math.Sin,
+	"cos":   math.Cos,
+	"tan":   math.Tan,
+	"floor": math.Floor,
+	"ceil":  math.Ceil,
+	"round": math.Round,
+}
+
+var constants = map[string]float64{
+	"pi": math.Pi,
+	"e":  math.E,
+}
+
+// Evaluate computes an arithmetic expression.
+func Evaluate(expr string) (float64, error) {
+	p := &parser{input: strings.ToLower(expr)}
+	v, err := p.expression()
+	if err != nil {
+		return 0, err
+	}
+	p.skipSpaces()
+	if p.pos != len(p.input) {
+		return 0, fmt.Errorf("%w: unexpected %q", errSyntax, p.input[p.pos:])
+	}
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0, errors.New("result is not a finite number")
+	}
+	return v, nil
+}
+
+// parser is a recursive-descent evaluator:
+//
+//	expression = term { ("+" | "-") term }
+//	term       = unary { ("*" | "/" | "%") unary }
+//	unary      = ( "+" | "-" ) unary | power
+//	power      = primary [ "^" unary ]
+//	primary    = number | constant | function "(" expression ")" | "(" expression ")"
+type parser struct {
+	input string
+	pos   int
+}
+
+func (p *parser) expression() (float64, error) {
+	v, err := p.term()
+	if err != nil {
+		return 0, err
+	}
+	for {
+		switch p.peek() {
+		case '+':
+			p.pos++
+			r, err := p.term()
+			if err != nil {
+				return 0, err
+			}
+			v += r
+		case '-':
+			p.pos++
+			r, err := p.term()
+			if err != nil {
+				return 0, err
+			}
+			v -= r
+		default:
+			return v, nil
+		}
+	}
+}
+
+func (p *parser) term() (float64, error) {
+	v, err := p.unary()
+	if err != nil {
+		return 0, err
+	}
+	for {
+		op := p.peek()
+		if op != '*' && op != '/' && op != '%' {
+			return v, nil
+		}
+		p.pos++
+		r, err := p.unary()
+		if err != nil {
+			return 0, err
+		}
+		switch op {
+		case '*':
+			v *= r
+		case '/':
+			if r == 0 {
+				return 0, errors.New("division by zero")
+			}
+			v /= r
+		case '%':
+			if r == 0 {
+				return 0, errors.New("division by zero")
+			}
+			v = math.Mod(v, r)
+		}
+	}
+}
+
+func (p *parser) power() (float64, error) {
+	base, err := p.primary()
+	if err != nil {
+		return 0, err
+	}
+	if p.peek() != '^' {
+		return base, nil
+	}
+	p.pos++
+	exp, err := p.unary()
+	if err != nil {
+		return 0, err
+	}
+	return math.Pow(base, exp), nil
+}
+
+func (p *parser) unary() (float64, error) {
+	switch p.peek() {
+	case '-':
+		p.pos++
+		v, err := p.unary()
+		return -v, err
+	case '+':
+		p.pos++
+		return p.unary()
+	}
+	return p.power()
+}
+
+func (p *parser) primary() (float64, error) {
+	c := p.peek()
+	switch {
+	case c == '(':
+		p.pos++
+		v, err := p.expression()
+		if err != nil {
+			return 0, err
+		}
+		if p.peek() != ')' {
+			return 0, fmt.Errorf("%w: missing )", errSyntax)
+		}
+		p.pos++
+		return v, nil
+	case c == '.' || unicode.IsDigit(rune(c)):
+		return p.number()
+	case unicode.IsLetter(rune(c)):
+		return p.identifier()
+	case c == 0:
+		return 0, fmt.Errorf("%w: unexpected end", errSyntax)
+	}
+	return 0, fmt.Errorf("%w: unexpected %q", errSyntax, string(c))
+}
+
+func (p *parser) number() (float64, error) {
+	start := p.pos
+	for p.pos < len(p.input) && (p.input[p.pos] == '.' || unicode.IsDigit(rune(p.input[p.pos]))) {
+		p.pos++
+	}
+	// scientific notation such as 1e-3
+	if p.pos < len(p.input) && p.input[p.pos] == 'e' {
+		end := p.pos + 1
+		if end < len(p.input) && (p.input[end] == '+' || p.input[end] == '-') {
+			end++
+		}
+		if end < len(p.input) && unicode.IsDigit(rune(p.input[end])) {
+			p.pos = end
+			for p.pos < len(p.input) && unicode.IsDigit(rune(p.input[p.pos])) {
+				p.pos++
+			}
+		}
+	}
+	v, err := strconv.ParseFloat(p.input[start:p.pos], 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: bad number %q", errSyntax, p.input[start:p.pos])
+	}
+	return v, nil
+}
+
+func (p *parser) identifier() (float64, error) {
+	start := p.pos
+	for p.pos < len(p.input) && unicode.IsLetter(rune(p.input[p.pos])) {
+		p.pos++
+	}
+	name := p.input[start:p.pos]
+
+	if v, ok := constants[name]; ok {
+		return v, nil
+	}
+	fn, ok := functions[name]
+	if !ok {
+		return 0, fmt.Errorf("%w: unknown name %q", errSyntax, name)
+	}
+	if p.peek() != '(' {
+		return 0, fmt.Errorf("%w: %s needs (", errSyntax, name)
+	}
+	p.pos++
+	arg, err := p.expression()
+	if err != nil {
+		return 0, err
+	}
+	if p.peek() != ')' {
+		return 0, fmt.Errorf("%w: missing )", errSyntax)
+	}
+	p.pos++
+	return fn(arg), nil
+}
+
+// peek skips whitespace and returns the next byte, or 0 at the end.
+func (p *parser) peek() byte {
+	p.skipSpaces()
+	if p.pos >= len(p.input) {
+		return 0
+	}
+	return p.input[p.pos]
+}
+
+func (p *parser) skipSpaces() {
+	for p.pos < len(p.input) && unicode.IsSpace(rune(p.input[p.pos])) {
+		p.pos++
+	}
+}
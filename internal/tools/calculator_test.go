@@ -0,0 +1,96 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestEvaluate(t *testing.T) {
+	tests := []struct {
+		expr string
+		want float64
+	}{
+		{"1 + 2", 3},
+		{"2 + 3 * 4", 14},
+		{"(2 + 3) * 4", 20},
+		{"10 - 4 - 3", 3},
+		{"12 / 4 / 3", 1},
+		{"7 % 3", 1},
+		{"2 ^ 3 ^ 2", 512},
+		{"-2 ^ 2", -4},
+		{"2 ^ -1", 0.5},
+		{"--3", 3},
+		{"+4", 4},
+		{".5 * 4", 2},
+		{"1e3 + 1E-3", 1000.001},
+		{"sqrt(16) + abs(-2)", 6},
+		{"floor(2.7) + ceil(2.1) + round(2.5)", 8},
+		{"log(1000)", 3},
+		{"ln(e)", 1},
+		{"2 * pi", 2 * math.Pi},
+		{"  SQRT( 9 )  ", 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			got, err := Evaluate(tt.expr)
+			if err != nil {
+				t.Fatalf("Evaluate(%q) error: %v", tt.expr, err)
+			}
+			if math.Abs(got-tt.want) > 1e-9 {
+				t.Fatalf("Evaluate(%q) = %v, want %v", tt.expr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvaluateErrors(t *testing.T) {
+	tests := []struct {
+		expr   string
+		syntax bool
+	}{
+		{"", true},
+		{"1 +", true},
+		{"(1 + 2", true},
+		{"1 + 2)", true},
+		{"2 3", true},
+		{"foo(1)", true},
+		{"sqrt 4", true},
+		{"sqrt(4", true},
+		{"1..2", true},
+		{"1 $ 2", true},
+		{"1 / 0", false},
+		{"5 % 0", false},
+		{"sqrt(-1)", false},
+		{"10 ^ 400", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, err := Evaluate(tt.expr)
+			if err == nil {
+				t.Fatalf("Evaluate(%q) succeeded, want an error", tt.expr)
+			}
+			if errors.Is(err, errSyntax) != tt.syntax {
+				t.Fatalf("Evaluate(%q) error = %v, syntax error %v", tt.expr, err, tt.syntax)
+			}
+		})
+	}
+}
+
+func TestCalculatorHandler(t *testing.T) {
+	handler := Calculator().Handler
+
+	got, err := handler(context.Background(), json.RawMessage(`{"expression": "0.1 + 0.2 * 10"}`))
+	if err != nil {
+		t.Fatalf("handler error: %v", err)
+	}
+	if got != "2.1" {
+		t.Fatalf("handler = %q, want 2.1", got)
+	}
+
+	if _, err := handler(context.Background(), json.RawMessage(`{"expression": 1}`)); err == nil {
+		t.Fatal("handler accepted a non-string expression")
+	}
+}
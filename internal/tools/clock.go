@@ -0,0 +1,49 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"chatgpt-telegram-bot/internal/usecase/chat"
+)
+
+// CurrentTime reports the current date and time, optionally in an IANA zone.
+func CurrentTime(now func() time.Time) chat.Tool {
+	return chat.Tool{
+		Definition: chat.ToolDefinition{
+			Name:        "current_time",
+			Description: "Get the current date and time. Use it for questions about today, now, weekdays or time zones.",
+			Parameters: json.RawMessage(`{
+				"type": "object",
+				"properties": {
+					"timezone": {
+						"type": "string",
+						"description": "IANA time zone such as Europe/Berlin; UTC when omitted"
+					}
+				}
+			}`),
+		},
+		Handler: func(_ context.Context, raw json.RawMessage) (string, error) {
+			var args struct {
+				Timezone string `json:"timezone"`
+			}
+			if err := json.Unmarshal(raw, &args); err != nil {
+				return "", err
+			}
+
+			loc := time.UTC
+			if args.Timezone != "" {
+				l, err := time.LoadLocation(args.Timezone)
+				if err != nil {
+					return "", fmt.Errorf("unknown time zone %q", args.Timezone)
+				}
+				loc = l
+			}
+
+			t := now().In(loc)
+			return fmt.Sprintf("%s (%s)", t.Format(time.RFC3339), t.Weekday()), nil
+		},
+	}
+}
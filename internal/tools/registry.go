@@ -0,0 +1,21 @@
+package tools
+
+import (
+	"time"
+
+	"chatgpt-telegram-bot/internal/usecase/chat"
+)
+
+// NewBuiltinRegistry returns a registry with the tools shipped with the bot.
+func NewBuiltinRegistry() (*chat.ToolRegistry, error) {
+	registry := chat.NewToolRegistry()
+	for _, tool := range []chat.Tool{
+		CurrentTime(time.Now),
+		Calculator(),
+	} {
+		if err := registry.Register(tool); err != nil {
+			return nil, err
+		}
+	}
+	return registry, nil
+}
@@ -0,0 +1,23 @@
+package tools
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestBuiltinRegistry(t *testing.T) {
+	registry, err := NewBuiltinRegistry()
+	if err != nil {
+		t.Fatalf("NewBuiltinRegistry() error: %v", err)
+	}
+
+	defs := registry.Definitions()
+	if len(defs) != 2 || defs[0].Name != "current_time" || defs[1].Name != "calculator" {
+		t.Fatalf("Definitions() = %+v, want current_time and calculator", defs)
+	}
+	for _, def := range defs {
+		if !json.Valid(def.Parameters) {
+			t.Fatalf("tool %s has an invalid schema", def.Name)
+		}
+	}
+}
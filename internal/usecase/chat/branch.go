@@ -0,0 +1,41 @@
+package chat
+
+import "chatgpt-telegram-bot/internal/domain"
+
+// branch finds the turn a new message follows. A reply continues the reply
+// chain of the message it answers, returned as thread; anything else follows
+// the latest stored turn and thread is nil.
+func (s *Service) branch(key int64, replyTo int) (parent int, thread []domain.Message) {
+	if last := s.store.List(key, 1); len(last) > 0 {
+		parent = last[0].MessageID
+	}
+	if replyTo == 0 {
+		return parent, nil
+	}
+
+	thread = s.store.Thread(key, replyTo, s.cfg.ContextLimit, s.cfg.ContextTTL)
+	if len(thread) == 0 {
+		// the message is unknown or expired
+		return parent, nil
+	}
+	if replyTo == parent && s.isTail(key, thread) {
+		// nothing branched off; keep the summarized history
+		return parent, nil
+	}
+	return replyTo, thread
+}
+
+// isTail reports whether thread holds exactly the latest fresh messages.
+// thread is a subset of them, so equal length and first message suffice.
+func (s *Service) isTail(key int64, thread []domain.Message) bool {
+	tail := s.store.FreshMessages(key, s.cfg.ContextLimit, s.cfg.ContextTTL)
+	return len(tail) == len(thread) &&
+		tail[0].MessageID == thread[0].MessageID && tail[0].Timestamp.Equal(thread[0].Timestamp)
+}
+
+// threadContext fits a reply chain into the model budget. The rolling summary
+// covers the latest turns, not the branch, so it is left out.
+func (s *Service) threadContext(model string, system, user Message, thread []domain.Message) (contextWindow, error) {
+	kept, trimmed, err := s.fitBudget(model, []Message{system, user}, toMessages(thread))
+	return contextWindow{history: kept, trimmed: trimmed}, err
+}
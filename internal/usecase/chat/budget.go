@@ -0,0 +1,87 @@
+package chat
+
+import (
+	"errors"
+	"unicode/utf8"
+
+	"chatgpt-telegram-bot/internal/config"
+	"chatgpt-telegram-bot/internal/domain"
+)
+
+var ErrContextTooLong = errors.New("message does not fit the model context window")
+
+// Tokenizer counts the tokens text takes for a model.
+type Tokenizer interface {
+	Count(model, text string) int
+}
+
+const (
+	// per-message framing added by the chat format
+	messageOverheadTokens = 4
+	// rough cost of a high-detail image tile set
+	imageTokens = 765
+)
+
+// contextBudget is the number of prompt tokens the model accepts once the
+// completion reserve is set aside. A window that cannot hold the reserve is
+// a misconfiguration and falls back to the default window.
+func (s *Service) contextBudget(model string) int {
+	window := s.cfg.ContextWindow
+	if w, ok := s.cfg.ModelContextWindows[model]; ok {
+		window = w
+	}
+	if window <= s.cfg.MaxCompletionTokens {
+		window = config.DefaultContextWindow
+	}
+	return window - s.cfg.MaxCompletionTokens
+}
+
+func (s *Service) countTokens(model string, m Message) int {
+	n := messageOverheadTokens + len(m.Images)*imageTokens
+	if s.tokenizer != nil {
+		return n + s.tokenizer.Count(model, m.Text)
+	}
+	return n + approxTokens(m.Text)
+}
+
+// fitBudget drops the oldest history until fixed and history fit the model
+// budget. It returns the kept history and how many messages were dropped.
+func (s *Service) fitBudget(model string, fixed []Message, history []Message) ([]Message, int, error) {
+	budget := s.contextBudget(model)
+	total := 0
+	for _, m := range fixed {
+		total += s.countTokens(model, m)
+	}
+	if total > budget {
+		return nil, len(history), ErrContextTooLong
+	}
+
+	costs := make([]int, len(history))
+	for i, h := range history {
+		costs[i] = s.countTokens(model, h)
+		total += costs[i]
+	}
+
+	start := 0
+	for start < len(history) && total > budget {
+		total -= costs[start]
+		start++
+	}
+	if start > 0 {
+		// do not open the context with a reply whose question was dropped
+		for start < len(history) && history[start].Role == domain.RoleAssistant {
+			start++
+		}
+	}
+
+	return history[start:], start, nil
+}
+
+// approxTokens estimates token usage at roughly four characters per token.
+func approxTokens(text string) int {
+	n := utf8.RuneCountInString(text)
+	if n == 0 {
+		return 0
+	}
+	return (n + 3) / 4
+}
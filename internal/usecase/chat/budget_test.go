@@ -0,0 +1,115 @@
+package chat
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"chatgpt-telegram-bot/internal/adapter/memory"
+	"chatgpt-telegram-bot/internal/config"
+)
+
+type fakeClient struct {
+	requests []CompletionRequest
+	reply    func(req CompletionRequest) string
+}
+
+func (c *fakeClient) Complete(_ context.Context, req CompletionRequest) (Completion, error) {
+	c.requests = append(c.requests, req)
+	text := "ok"
+	if c.reply != nil {
+		text = c.reply(req)
+	}
+	return Completion{Text: text}, nil
+}
+
+func newTestService(client Client, cfg config.Config) *Service {
+	if cfg.Model == "" {
+		cfg.Model = "gpt-test"
+	}
+	if cfg.ContextLimit == 0 {
+		cfg.ContextLimit = 20
+	}
+	if cfg.ContextTTL == 0 {
+		cfg.ContextTTL = time.Hour
+	}
+	store := memory.NewStore(memory.Options{})
+	return NewService(store, memory.NewSettingsStore(), client, nil, nil, cfg)
+}
+
+func TestContextBudgetFallsBackWithoutWindow(t *testing.T) {
+	tests := []struct {
+		name   string
+		window int
+	}{
+		{"unset", 0},
+		{"smaller than the completion reserve", 1000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestService(&fakeClient{}, config.Config{
+				ContextWindow:       tt.window,
+				MaxCompletionTokens: 4096,
+			})
+			if got, want := s.contextBudget("gpt-test"), config.DefaultContextWindow-4096; got != want {
+				t.Fatalf("contextBudget() = %d, want %d", got, want)
+			}
+		})
+	}
+}
+
+func TestContextBudgetUsesModelWindow(t *testing.T) {
+	s := newTestService(&fakeClient{}, config.Config{
+		ContextWindow:       8000,
+		ModelContextWindows: map[string]int{"big": 400000},
+		MaxCompletionTokens: 1000,
+	})
+	if got := s.contextBudget("gpt-test"); got != 7000 {
+		t.Fatalf("contextBudget(default) = %d, want 7000", got)
+	}
+	if got := s.contextBudget("big"); got != 399000 {
+		t.Fatalf("contextBudget(big) = %d, want 399000", got)
+	}
+}
+
+func TestHandleMessageWithUnsetWindow(t *testing.T) {
+	client := &fakeClient{}
+	s := newTestService(client, config.Config{MaxCompletionTokens: 4096})
+	conv := Conversation{ChatID: 1}
+
+	for _, text := range []string{"hello", "how are you?"} {
+		if _, err := s.HandleMessage(context.Background(), conv, Input{Text: text}); err != nil {
+			t.Fatalf("HandleMessage(%q) error: %v", text, err)
+		}
+	}
+
+	last := client.requests[len(client.requests)-1]
+	// system prompt, previous exchange and the new message
+	if len(last.Messages) != 4 {
+		t.Fatalf("request carried %d messages, want 4", len(last.Messages))
+	}
+}
+
+func TestFitBudgetDropsOldestHistory(t *testing.T) {
+	s := newTestService(&fakeClient{}, config.Config{
+		ContextWindow:       200,
+		MaxCompletionTokens: 100,
+	})
+	fixed := []Message{{Role: "system", Text: "be brief"}}
+	history := []Message{
+		{Role: "user", Text: strings.Repeat("word ", 200)},
+		{Role: "assistant", Text: "first answer"},
+		{Role: "user", Text: "second question"},
+		{Role: "assistant", Text: "second answer"},
+	}
+
+	kept, dropped, err := s.fitBudget("gpt-test", fixed, history)
+	if err != nil {
+		t.Fatalf("fitBudget() error: %v", err)
+	}
+	// the reply to the dropped question goes with it
+	if dropped != 2 || len(kept) != 2 || kept[0].Text != "second question" {
+		t.Fatalf("fitBudget() kept %+v, dropped %d; want the second exchange", kept, dropped)
+	}
+}
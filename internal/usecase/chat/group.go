@@ -0,0 +1,84 @@
+package chat
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/fnv"
+)
+
+const (
+	// GroupReplyMention answers group messages that mention or reply to the
+	// bot, or are commands; GroupReplyAll answers every message.
+	GroupReplyMention = "mention"
+	GroupReplyAll     = "all"
+
+	// GroupContextShared keeps one conversation per group, GroupContextUser
+	// one per member.
+	GroupContextShared = "shared"
+	GroupContextUser   = "user"
+)
+
+var ErrUnknownGroupMode = errors.New("unknown group mode")
+
+// Conversation addresses a stored history. UserID is set for members of a
+// group with per-user context; settings always belong to the chat.
+type Conversation struct {
+	ChatID int64
+	UserID int64
+}
+
+// key is the ID the history is stored under. Per-user conversations hash to
+// IDs at or above 1<<62, which Telegram chat IDs never reach.
+func (c Conversation) key() int64 {
+	if c.UserID == 0 {
+		return c.ChatID
+	}
+	var buf [16]byte
+	binary.LittleEndian.PutUint64(buf[:8], uint64(c.ChatID))
+	binary.LittleEndian.PutUint64(buf[8:], uint64(c.UserID))
+	h := fnv.New64a()
+	h.Write(buf[:])
+	return int64(h.Sum64()>>2 | 1<<62)
+}
+
+// GroupPolicy decides which group messages the bot answers and whose
+// context they share.
+type GroupPolicy struct {
+	ReplyMode string
+	Context   string
+}
+
+func (s *Service) GroupPolicy(chatID int64) GroupPolicy {
+	settings := s.settings.Settings(chatID)
+	policy := GroupPolicy{
+		ReplyMode: s.cfg.GroupReplyMode,
+		Context:   s.cfg.GroupContext,
+	}
+	if settings.GroupReplyMode != "" {
+		policy.ReplyMode = settings.GroupReplyMode
+	}
+	if settings.GroupContext != "" {
+		policy.Context = settings.GroupContext
+	}
+	return policy
+}
+
+func (s *Service) SetGroupReplyMode(chatID int64, mode string) error {
+	if mode != GroupReplyMention && mode != GroupReplyAll {
+		return ErrUnknownGroupMode
+	}
+	settings := s.settings.Settings(chatID)
+	settings.GroupReplyMode = mode
+	s.settings.SaveSettings(chatID, settings)
+	return nil
+}
+
+func (s *Service) SetGroupContext(chatID int64, mode string) error {
+	if mode != GroupContextShared && mode != GroupContextUser {
+		return ErrUnknownGroupMode
+	}
+	settings := s.settings.Settings(chatID)
+	settings.GroupContext = mode
+	s.settings.SaveSettings(chatID, settings)
+	return nil
+}
@@ -3,6 +3,7 @@ package chat
 import (
 	"context"
 	"errors"
+	"slices"
 	"strings"
 	"time"
 
@@ -10,27 +11,94 @@ import (
 	"chatgpt-telegram-bot/internal/domain"
 )
 
-var ErrEmptyMessage = errors.New("empty message")
+var (
+	ErrEmptyMessage   = errors.New("empty message")
+	ErrUnknownModel   = errors.New("model is not in the allow-list")
+	ErrUnknownPersona = errors.New("unknown persona")
+	ErrNoUserTurn     = errors.New("no user message to answer again")
+	ErrImageTurn      = errors.New("message with images cannot be answered again")
+)
+
+const continuePrompt = "Continue exactly where your previous answer stopped. Do not repeat what you already wrote."
+
+// imagePlaceholder stands in for the images of a stored user turn.
+const imagePlaceholder = "[image attached]"
 
 type Client interface {
-	Complete(ctx context.Context, req CompletionRequest) (string, error)
+	Complete(ctx context.Context, req CompletionRequest) (Completion, error)
+}
+
+// StreamingClient is implemented by clients that can deliver the reply
+// incrementally. onDelta receives each new chunk of text; returning an error
+// aborts the stream.
+type StreamingClient interface {
+	CompleteStream(ctx context.Context, req CompletionRequest, onDelta func(delta string) error) (Completion, error)
+}
+
+// ModelRouter is implemented by clients that may answer with another model
+// than the chat's, for example one that can see images. The service asks it
+// before fitting the context so the budget matches the model that answers.
+type ModelRouter interface {
+	RouteModel(model string, images bool, promptTokens int) string
 }
 
+// ToolChoiceNone forbids tool calls while still describing the tools.
+const ToolChoiceNone = "none"
+
 type CompletionRequest struct {
 	Model               string
 	Messages            []Message
 	MaxCompletionTokens int
+	Temperature         *float32 // nil keeps the model's default
+	Tools               []ToolDefinition
+	ToolChoice          string
+}
+
+// Completion is a single model response. It carries either text, tool calls
+// or both.
+type Completion struct {
+	Text      string
+	ToolCalls []ToolCall
+	Usage     Usage
+	// Truncated is set when the model stopped at the completion token limit.
+	Truncated bool
+}
+
+// Usage is the token count billed for requests to a model.
+type Usage struct {
+	Model            string
+	PromptTokens     int
+	CompletionTokens int
 }
 
 type Message struct {
-	Role   string
-	Text   string
-	Images []string
+	Role       string
+	Text       string
+	Images     []string
+	ToolCalls  []ToolCall
+	ToolCallID string
+}
+
+// Reply is the assistant answer to a user message.
+type Reply struct {
+	Text string
+	// Trimmed is how many older messages were left out to fit the context window.
+	Trimmed int
+	// Usage lists the tokens spent per model, including summarization.
+	Usage []Usage
+	// Truncated is set when the reply was cut off by the token limit.
+	Truncated bool
+
+	parent int
 }
 
 type Input struct {
 	Text   string
 	Images []Image
+	// MessageID is the Telegram message of the input; ReplyTo is the bot
+	// message it replies to, which makes the answer branch off there.
+	MessageID int
+	ReplyTo   int
 }
 
 type Image struct {
@@ -38,45 +106,268 @@ type Image struct {
 }
 
 type Service struct {
-	store  domain.ConversationStore
-	client Client
-	cfg    config.Config
-	now    func() time.Time
+	store     domain.ConversationStore
+	settings  domain.SettingsStore
+	client    Client
+	tokenizer Tokenizer
+	tools     *ToolRegistry
+	cfg       config.Config
+	now       func() time.Time
 }
 
-func NewService(store domain.ConversationStore, client Client, cfg config.Config) *Service {
+func NewService(store domain.ConversationStore, settings domain.SettingsStore, client Client, tokenizer Tokenizer, tools *ToolRegistry, cfg config.Config) *Service {
 	return &Service{
-		store:  store,
-		client: client,
-		cfg:    cfg,
-		now:    time.Now,
+		store:     store,
+		settings:  settings,
+		client:    client,
+		tokenizer: tokenizer,
+		tools:     tools,
+		cfg:       cfg,
+		now:       time.Now,
 	}
 }
 
-func (s *Service) HandleMessage(ctx context.Context, chatID int64, input Input) (string, error) {
-	if strings.TrimSpace(input.Text) == "" && len(input.Images) == 0 {
-		return "", ErrEmptyMessage
+func (s *Service) HandleMessage(ctx context.Context, conv Conversation, input Input) (Reply, error) {
+	return s.handle(ctx, conv, input, nil)
+}
+
+// HandleMessageStream works like HandleMessage but reports the reply through
+// onDelta as it is generated. Clients without streaming support deliver each
+// completion as a single delta.
+func (s *Service) HandleMessageStream(ctx context.Context, conv Conversation, input Input, onDelta func(delta string) error) (Reply, error) {
+	return s.handle(ctx, conv, input, onDelta)
+}
+
+// Regenerate answers the last user message again, replacing the stored reply
+// to it. The reply is streamed through onDelta when it is set.
+func (s *Service) Regenerate(ctx context.Context, conv Conversation, onDelta func(delta string) error) (Reply, error) {
+	last := s.store.List(conv.key(), 2)
+	drop := 0
+	if n := len(last); n > 0 && last[n-1].Role == domain.RoleAssistant {
+		last = last[:n-1]
+		drop++
+	}
+	if len(last) == 0 || last[len(last)-1].Role != domain.RoleUser {
+		return Reply{}, ErrNoUserTurn
 	}
 
-	userMessage := domain.Message{
-		Role:      domain.RoleUser,
-		Content:   buildStoredContent(input),
-		Timestamp: s.now(),
+	user := last[len(last)-1]
+	// only the placeholder of the images was stored
+	if strings.HasSuffix(user.Content, imagePlaceholder) {
+		return Reply{}, ErrImageTurn
+	}
+	s.store.DeleteLast(conv.key(), drop+1)
+	return s.handle(ctx, conv, Input{Text: user.Content, MessageID: user.MessageID, ReplyTo: user.ParentID}, onDelta)
+}
+
+// Continue asks the model to carry on with a reply that hit the token limit.
+// The reply is streamed through onDelta when it is set.
+func (s *Service) Continue(ctx context.Context, conv Conversation, onDelta func(delta string) error) (Reply, error) {
+	input := Input{Text: continuePrompt}
+	if last := s.store.List(conv.key(), 1); len(last) > 0 {
+		// stay on the branch the reply was on
+		input.ReplyTo = last[0].MessageID
+	}
+	return s.handle(ctx, conv, input, onDelta)
+}
+
+func (s *Service) handle(ctx context.Context, conv Conversation, input Input, onDelta func(delta string) error) (Reply, error) {
+	req, window, err := s.prepare(ctx, conv, input)
+	if err != nil {
+		return Reply{}, err
+	}
+
+	var streamed strings.Builder
+	if onDelta != nil {
+		forward := onDelta
+		onDelta = func(delta string) error {
+			streamed.WriteString(delta)
+			return forward(delta)
+		}
+	}
+
+	resp, err := s.complete(ctx, req, onDelta)
+	if errors.Is(err, context.Canceled) {
+		// a stopped reply keeps what was shown; with nothing shown the user
+		// turn goes too so the history does not end on an unanswered message
+		if streamed.Len() == 0 {
+			s.store.DeleteLast(conv.key(), 1)
+			return Reply{}, err
+		}
+		s.storeReply(conv, streamed.String(), window.parent)
+		return newReply(Completion{Text: streamed.String()}, window), err
+	}
+	if err != nil {
+		return Reply{}, err
+	}
+
+	s.storeReply(conv, resp.Text, window.parent)
+	return newReply(resp, window), nil
+}
+
+// LinkReply records messageID as the Telegram message carrying reply, so
+// replies to it can branch off there.
+func (s *Service) LinkReply(conv Conversation, reply Reply, messageID int) {
+	if reply.parent == 0 || messageID == 0 {
+		return
 	}
+	s.store.SetReplyID(conv.key(), reply.parent, messageID)
+}
 
-	history := s.store.FreshMessages(chatID, s.cfg.ContextLimit, s.cfg.ContextTTL)
-	s.store.Add(chatID, userMessage)
+// LatestReplyID returns the Telegram message carrying the latest reply of
+// conv, or 0 when the latest turn is not a reply linked to a message.
+func (s *Service) LatestReplyID(conv Conversation) int {
+	last := s.store.List(conv.key(), 1)
+	if len(last) == 0 || last[0].Role != domain.RoleAssistant {
+		return 0
+	}
+	return last[0].MessageID
+}
 
-	messages := make([]Message, 0, len(history)+2)
-	messages = append(messages, Message{
+// Models returns the models a chat may switch between.
+func (s *Service) Models() []string {
+	return s.cfg.Models
+}
+
+// Profile is the effective per-chat configuration of a request.
+type Profile struct {
+	Model       string
+	Prompt      string
+	Persona     string
+	Temperature *float32
+}
+
+// Profile resolves the chat's settings on top of the defaults: a persona
+// replaces the prompt, model and temperature, a custom system prompt replaces
+// the prompt and a model picked with SetModel wins over the persona's model.
+func (s *Service) Profile(chatID int64) Profile {
+	settings := s.settings.Settings(chatID)
+	profile := Profile{
+		Model:  s.cfg.Model,
+		Prompt: s.cfg.AssistantPrompt,
+	}
+	if persona, ok := s.persona(settings.Persona); ok {
+		profile.Persona = persona.Name
+		profile.Prompt = persona.Prompt
+		profile.Temperature = persona.Temperature
+		if persona.Model != "" {
+			profile.Model = persona.Model
+		}
+	}
+	if settings.SystemPrompt != "" {
+		profile.Prompt = settings.SystemPrompt
+	}
+	if settings.Model != "" && slices.Contains(s.cfg.Models, settings.Model) {
+		profile.Model = settings.Model
+	}
+	return profile
+}
+
+func (s *Service) Model(chatID int64) string {
+	return s.Profile(chatID).Model
+}
+
+func (s *Service) SetModel(chatID int64, model string) error {
+	if !slices.Contains(s.cfg.Models, model) {
+		return ErrUnknownModel
+	}
+	settings := s.settings.Settings(chatID)
+	settings.Model = model
+	s.settings.SaveSettings(chatID, settings)
+	return nil
+}
+
+// SetSystemPrompt stores a chat-specific system prompt; an empty prompt
+// restores the default.
+func (s *Service) SetSystemPrompt(chatID int64, prompt string) {
+	settings := s.settings.Settings(chatID)
+	settings.SystemPrompt = strings.TrimSpace(prompt)
+	s.settings.SaveSettings(chatID, settings)
+}
+
+func (s *Service) Personas() []config.Persona {
+	return s.cfg.Personas
+}
+
+// SetPersona switches the chat to a named persona, dropping any custom
+// system prompt and model so the persona's own apply. An empty name clears it.
+func (s *Service) SetPersona(chatID int64, name string) error {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name != "" {
+		if _, ok := s.persona(name); !ok {
+			return ErrUnknownPersona
+		}
+	}
+	settings := s.settings.Settings(chatID)
+	settings.Persona = name
+	settings.SystemPrompt = ""
+	settings.Model = ""
+	s.settings.SaveSettings(chatID, settings)
+	return nil
+}
+
+func (s *Service) persona(name string) (config.Persona, bool) {
+	if name == "" {
+		return config.Persona{}, false
+	}
+	for _, p := range s.cfg.Personas {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return config.Persona{}, false
+}
+
+// Reset forgets a stored conversation.
+func (s *Service) Reset(conv Conversation) {
+	s.store.Clear(conv.key())
+}
+
+// History returns up to limit most recent stored messages, ignoring the TTL.
+func (s *Service) History(conv Conversation, limit int) []domain.Message {
+	return s.store.List(conv.key(), limit)
+}
+
+// ContextStats describes what the next request would carry before the new
+// user message is added.
+type ContextStats struct {
+	Messages   int
+	Tokens     int
+	Budget     int
+	Trimmed    int
+	Summarized bool
+}
+
+func (s *Service) Context(ctx context.Context, conv Conversation) ContextStats {
+	profile := s.Profile(conv.ChatID)
+	system := Message{Role: domain.RoleSystem, Text: profile.Prompt}
+
+	window, _ := s.buildContext(ctx, conv.key(), profile.Model, system, Message{}, false)
+	stats := ContextStats{
+		Messages:   len(window.history),
+		Tokens:     s.countTokens(profile.Model, system),
+		Budget:     s.contextBudget(profile.Model),
+		Trimmed:    window.trimmed,
+		Summarized: window.summary.Text != "",
+	}
+	if stats.Summarized {
+		stats.Tokens += s.countTokens(profile.Model, window.summary)
+	}
+	for _, m := range window.history {
+		stats.Tokens += s.countTokens(profile.Model, m)
+	}
+	return stats
+}
+
+func (s *Service) prepare(ctx context.Context, conv Conversation, input Input) (CompletionRequest, contextWindow, error) {
+	if strings.TrimSpace(input.Text) == "" && len(input.Images) == 0 {
+		return CompletionRequest{}, contextWindow{}, ErrEmptyMessage
+	}
+
+	profile := s.Profile(conv.ChatID)
+	system := Message{
 		Role: domain.RoleSystem,
-		Text: s.cfg.AssistantPrompt,
-	})
-	for _, h := range history {
-		messages = append(messages, Message{
-			Role: h.Role,
-			Text: h.Content,
-		})
+		Text: profile.Prompt,
 	}
 	userParts := Message{
 		Role: domain.RoleUser,
@@ -85,24 +376,84 @@ func (s *Service) HandleMessage(ctx context.Context, chatID int64, input Input)
 	for _, img := range input.Images {
 		userParts.Images = append(userParts.Images, img.DataURL)
 	}
+
+	model := profile.Model
+	if router, ok := s.client.(ModelRouter); ok {
+		model = router.RouteModel(model, len(userParts.Images) > 0, s.countTokens(model, userParts))
+	}
+
+	parent, thread := s.branch(conv.key(), input.ReplyTo)
+	var (
+		window contextWindow
+		err    error
+	)
+	if thread != nil {
+		window, err = s.threadContext(model, system, userParts, thread)
+	} else {
+		window, err = s.buildContext(ctx, conv.key(), model, system, userParts, true)
+	}
+	if err != nil {
+		return CompletionRequest{}, contextWindow{}, err
+	}
+
+	s.store.Add(conv.key(), domain.Message{
+		Role:      domain.RoleUser,
+		Content:   buildStoredContent(input),
+		Timestamp: s.now(),
+		MessageID: input.MessageID,
+		ParentID:  parent,
+	})
+	// a turn without a message of its own, like a continue prompt, is left
+	// out of reply chains
+	window.parent = parent
+	if input.MessageID != 0 {
+		window.parent = input.MessageID
+	}
+
+	messages := make([]Message, 0, len(window.history)+3)
+	messages = append(messages, system)
+	if window.summary.Text != "" {
+		messages = append(messages, window.summary)
+	}
+	messages = append(messages, window.history...)
 	messages = append(messages, userParts)
 
-	resp, err := s.client.Complete(ctx, CompletionRequest{
-		Model:               s.cfg.Model,
+	return CompletionRequest{
+		Model:               model,
 		Messages:            messages,
 		MaxCompletionTokens: s.cfg.MaxCompletionTokens,
-	})
-	if err != nil {
-		return "", err
-	}
+		Temperature:         profile.Temperature,
+	}, window, nil
+}
 
-	s.store.Add(chatID, domain.Message{
+func (s *Service) storeReply(conv Conversation, resp string, parent int) {
+	s.store.Add(conv.key(), domain.Message{
 		Role:      domain.RoleAssistant,
 		Content:   resp,
 		Timestamp: s.now(),
+		ParentID:  parent,
 	})
+}
 
-	return resp, nil
+func newReply(resp Completion, window contextWindow) Reply {
+	return Reply{
+		Text:      resp.Text,
+		Trimmed:   window.trimmed,
+		Usage:     append(window.usage, resp.Usage),
+		Truncated: resp.Truncated,
+		parent:    window.parent,
+	}
+}
+
+func toMessages(history []domain.Message) []Message {
+	res := make([]Message, 0, len(history))
+	for _, h := range history {
+		res = append(res, Message{
+			Role: h.Role,
+			Text: h.Content,
+		})
+	}
+	return res
 }
 
 func buildStoredContent(input Input) string {
@@ -111,7 +462,7 @@ func buildStoredContent(input Input) string {
 		if content != "" {
 			content += "\n"
 		}
-		content += "[image attached]"
+		content += imagePlaceholder
 	}
 	return content
 }
@@ -0,0 +1,105 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"chatgpt-telegram-bot/internal/config"
+	"chatgpt-telegram-bot/internal/domain"
+)
+
+// stoppingClient streams deltas and then fails as if the stream was stopped.
+type stoppingClient struct {
+	fakeClient
+	deltas []string
+}
+
+func (c *stoppingClient) CompleteStream(_ context.Context, _ CompletionRequest, onDelta func(string) error) (Completion, error) {
+	for _, d := range c.deltas {
+		if err := onDelta(d); err != nil {
+			return Completion{}, err
+		}
+	}
+	return Completion{}, context.Canceled
+}
+
+func TestStoppedReplyKeepsStreamedText(t *testing.T) {
+	s := newTestService(&stoppingClient{deltas: []string{"Once upon", " a time"}}, config.Config{})
+	conv := Conversation{ChatID: 1}
+
+	_, err := s.HandleMessageStream(context.Background(), conv, Input{Text: "tell a story"}, func(string) error { return nil })
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("HandleMessageStream() error = %v, want context.Canceled", err)
+	}
+
+	history := s.History(conv, 10)
+	if len(history) != 2 || history[1].Role != domain.RoleAssistant || history[1].Content != "Once upon a time" {
+		t.Fatalf("History() = %+v, want the question and the partial reply", history)
+	}
+}
+
+func TestStoppedReplyWithoutTextDropsTurn(t *testing.T) {
+	s := newTestService(&stoppingClient{}, config.Config{})
+	conv := Conversation{ChatID: 1}
+
+	_, err := s.HandleMessageStream(context.Background(), conv, Input{Text: "tell a story"}, func(string) error { return nil })
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("HandleMessageStream() error = %v, want context.Canceled", err)
+	}
+	if history := s.History(conv, 10); len(history) != 0 {
+		t.Fatalf("History() = %+v, want it empty", history)
+	}
+}
+
+func TestRegenerateRefusesImageTurn(t *testing.T) {
+	client := &fakeClient{}
+	s := newTestService(client, config.Config{})
+	conv := Conversation{ChatID: 1}
+
+	input := Input{Text: "what is this?", Images: []Image{{DataURL: "data:image/png;base64,AAAA"}}}
+	if _, err := s.HandleMessage(context.Background(), conv, input); err != nil {
+		t.Fatalf("HandleMessage() error: %v", err)
+	}
+
+	if _, err := s.Regenerate(context.Background(), conv, nil); !errors.Is(err, ErrImageTurn) {
+		t.Fatalf("Regenerate() error = %v, want ErrImageTurn", err)
+	}
+	if len(client.requests) != 1 || len(s.History(conv, 10)) != 2 {
+		t.Fatalf("Regenerate() changed the conversation: %d requests, history %+v", len(client.requests), s.History(conv, 10))
+	}
+}
+
+func TestLatestReplyID(t *testing.T) {
+	s := newTestService(&fakeClient{}, config.Config{})
+	conv := Conversation{ChatID: 1}
+
+	if got := s.LatestReplyID(conv); got != 0 {
+		t.Fatalf("LatestReplyID() of an empty conversation = %d, want 0", got)
+	}
+
+	ask := func(text string, messageID, replyID int) {
+		t.Helper()
+		reply, err := s.HandleMessage(context.Background(), conv, Input{Text: text, MessageID: messageID})
+		if err != nil {
+			t.Fatalf("HandleMessage(%q) error: %v", text, err)
+		}
+		s.LinkReply(conv, reply, replyID)
+	}
+
+	ask("first", 10, 11)
+	if got := s.LatestReplyID(conv); got != 11 {
+		t.Fatalf("LatestReplyID() = %d, want 11", got)
+	}
+
+	ask("second", 12, 13)
+	if got := s.LatestReplyID(conv); got != 13 {
+		t.Fatalf("LatestReplyID() after a newer reply = %d, want 13", got)
+	}
+
+	// a reply that was never linked to a message cannot be matched
+	ask("third", 14, 0)
+	if got := s.LatestReplyID(conv); got != 0 {
+		t.Fatalf("LatestReplyID() with an unlinked reply = %d, want 0", got)
+	}
+}
@@ -0,0 +1,147 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"chatgpt-telegram-bot/internal/domain"
+)
+
+const summaryPrompt = `You maintain a running summary of a chat between a user and an assistant.
+Merge the previous summary with the new messages into one concise summary.
+Keep facts about the user, decisions made, constraints, open questions and anything
+the assistant promised. Drop small talk. Write in the language of the conversation.`
+
+// contextWindow is the history of a chat prepared for the next request.
+type contextWindow struct {
+	summary Message
+	history []Message
+	trimmed int
+	usage   []Usage
+	// parent is the message ID the reply will follow.
+	parent int
+}
+
+func (w contextWindow) fixed(system, user Message) []Message {
+	if w.summary.Text == "" {
+		return []Message{system, user}
+	}
+	return []Message{system, w.summary, user}
+}
+
+func (s *Service) summariesEnabled() bool {
+	return s.cfg.SummaryModel != ""
+}
+
+// buildContext loads the history stored under key and fits it into the model budget.
+// With summaries enabled, turns that overflow the message limit or the token
+// budget are folded into the rolling summary when fold is set.
+func (s *Service) buildContext(ctx context.Context, key int64, model string, system, user Message, fold bool) (contextWindow, error) {
+	if !s.summariesEnabled() {
+		history := toMessages(s.store.FreshMessages(key, s.cfg.ContextLimit, s.cfg.ContextTTL))
+		kept, trimmed, err := s.fitBudget(model, []Message{system, user}, history)
+		return contextWindow{history: kept, trimmed: trimmed}, err
+	}
+
+	// like the turns it condenses, a summary expires after the TTL
+	summary := s.store.Summary(key)
+	if !summary.UpdatedAt.After(s.now().Add(-s.cfg.ContextTTL)) {
+		summary = domain.Summary{}
+	}
+
+	// unsummarized turns; they stay in context until enough overflow the limit
+	stored := s.store.FreshMessages(key, s.cfg.ContextLimit+s.cfg.SummaryTrigger, s.cfg.ContextTTL)
+	pending := make([]domain.Message, 0, len(stored))
+	for _, m := range stored {
+		if m.Timestamp.After(summary.Until) {
+			pending = append(pending, m)
+		}
+	}
+
+	var folded []domain.Message
+	if overflow := len(pending) - s.cfg.ContextLimit; overflow > 0 && overflow >= s.cfg.SummaryTrigger {
+		folded, pending = pending[:overflow], pending[overflow:]
+	}
+
+	window := contextWindow{summary: summaryMessage(summary)}
+	kept, dropped, err := s.fitBudget(model, window.fixed(system, user), toMessages(pending))
+	if err != nil {
+		return contextWindow{}, err
+	}
+	folded = append(folded, pending[:dropped]...)
+	pending = pending[dropped:]
+
+	if fold && len(folded) > 0 {
+		next, usage, err := s.summarize(ctx, summary.Content, folded)
+		if usage.Model != "" {
+			// a failed request has no usage, an empty summary was still billed
+			window.usage = append(window.usage, usage)
+		}
+		if err != nil {
+			log.Printf("failed to summarize conversation %d: %v", key, err)
+			window.trimmed = len(folded)
+		} else {
+			summary = domain.Summary{
+				Content:   next,
+				Until:     folded[len(folded)-1].Timestamp,
+				UpdatedAt: s.now(),
+			}
+			s.store.SaveSummary(key, summary)
+			window.summary = summaryMessage(summary)
+		}
+	}
+
+	// the new summary may be longer than the turns it replaced
+	kept, dropped, err = s.fitBudget(model, window.fixed(system, user), toMessages(pending))
+	if err != nil {
+		return contextWindow{}, err
+	}
+	window.history = kept
+	window.trimmed += dropped
+	return window, nil
+}
+
+func (s *Service) summarize(ctx context.Context, previous string, msgs []domain.Message) (string, Usage, error) {
+	var sb strings.Builder
+	if previous != "" {
+		sb.WriteString("Previous summary:\n")
+		sb.WriteString(previous)
+		sb.WriteString("\n\n")
+	}
+	sb.WriteString("New messages:\n")
+	for _, m := range msgs {
+		fmt.Fprintf(&sb, "%s: %s\n", m.Role, m.Content)
+	}
+
+	resp, err := s.client.Complete(ctx, CompletionRequest{
+		Model: s.cfg.SummaryModel,
+		Messages: []Message{
+			{Role: domain.RoleSystem, Text: summaryPrompt},
+			{Role: domain.RoleUser, Text: sb.String()},
+		},
+		MaxCompletionTokens: s.cfg.SummaryMaxTokens,
+	})
+	if err != nil {
+		return "", Usage{}, err
+	}
+	if resp.Usage.Model == "" {
+		resp.Usage.Model = s.cfg.SummaryModel
+	}
+	text := strings.TrimSpace(resp.Text)
+	if text == "" {
+		return "", resp.Usage, fmt.Errorf("empty summary")
+	}
+	return text, resp.Usage, nil
+}
+
+func summaryMessage(summary domain.Summary) Message {
+	if summary.Content == "" {
+		return Message{}
+	}
+	return Message{
+		Role: domain.RoleSystem,
+		Text: "Summary of the earlier conversation:\n" + summary.Content,
+	}
+}
@@ -0,0 +1,124 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"chatgpt-telegram-bot/internal/adapter/memory"
+	"chatgpt-telegram-bot/internal/config"
+	"chatgpt-telegram-bot/internal/domain"
+)
+
+func TestSummaryExpiresWithTTL(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+
+	client := &fakeClient{reply: func(req CompletionRequest) string {
+		if req.Model == "summary-model" {
+			return "the user is planning a trip to Rome"
+		}
+		return "ok"
+	}}
+	store := memory.NewStore(memory.Options{TTL: time.Hour, Now: clock})
+	s := NewService(store, memory.NewSettingsStore(), client, nil, nil, config.Config{
+		Model:               "gpt-test",
+		ContextLimit:        2,
+		ContextTTL:          time.Hour,
+		MaxCompletionTokens: 1000,
+		SummaryModel:        "summary-model",
+		SummaryTrigger:      2,
+	})
+	s.now = clock
+	conv := Conversation{ChatID: 1}
+
+	ask := func(text string) []Message {
+		t.Helper()
+		if _, err := s.HandleMessage(context.Background(), conv, Input{Text: text}); err != nil {
+			t.Fatalf("HandleMessage(%q) error: %v", text, err)
+		}
+		return client.requests[len(client.requests)-1].Messages
+	}
+
+	for _, text := range []string{"i want to visit Rome", "in spring", "what should i pack?"} {
+		ask(text)
+		now = now.Add(time.Minute)
+	}
+	if got := store.Summary(conv.key()); got.Content == "" {
+		t.Fatal("overflowing turns were not summarized")
+	}
+
+	now = now.Add(30 * time.Minute)
+	if msgs := ask("and for the evenings?"); !strings.Contains(msgs[1].Text, "trip to Rome") {
+		t.Fatalf("request within the TTL = %+v, want the summary after the system prompt", msgs)
+	}
+
+	now = now.Add(2 * time.Hour)
+	store.Sweep()
+	if got := store.Summary(conv.key()); got.Content != "" {
+		t.Fatalf("Summary() = %+v, want it expired", got)
+	}
+	if msgs := ask("remind me where i am going"); len(msgs) != 2 {
+		t.Fatalf("request after the TTL = %+v, want only the system prompt and the new message", msgs)
+	}
+}
+
+// summaryClient answers chat requests and hands summary requests to summary.
+type summaryClient struct {
+	summary func() (string, error)
+}
+
+func (c *summaryClient) Complete(_ context.Context, req CompletionRequest) (Completion, error) {
+	text := "ok"
+	if req.Model == "summary-model" {
+		var err error
+		if text, err = c.summary(); err != nil {
+			return Completion{}, err
+		}
+	}
+	return Completion{Text: text, Usage: Usage{Model: req.Model, PromptTokens: 10}}, nil
+}
+
+func TestSummaryUsage(t *testing.T) {
+	tests := []struct {
+		name       string
+		summary    func() (string, error)
+		wantModels []string
+	}{
+		{"summarized", func() (string, error) { return "a summary", nil }, []string{"summary-model", "gpt-test"}},
+		{"empty summary", func() (string, error) { return " ", nil }, []string{"summary-model", "gpt-test"}},
+		{"failed", func() (string, error) { return "", errors.New("boom") }, []string{"gpt-test"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestService(&summaryClient{summary: tt.summary}, config.Config{
+				ContextLimit:        2,
+				MaxCompletionTokens: 1000,
+				SummaryModel:        "summary-model",
+				SummaryTrigger:      2,
+			})
+			conv := Conversation{ChatID: 1}
+			for i, text := range []string{"one", "two", "three", "four"} {
+				role := domain.RoleUser
+				if i%2 == 1 {
+					role = domain.RoleAssistant
+				}
+				s.store.Add(conv.key(), domain.Message{Role: role, Content: text, Timestamp: time.Now()})
+			}
+
+			reply, err := s.HandleMessage(context.Background(), conv, Input{Text: "five"})
+			if err != nil {
+				t.Fatalf("HandleMessage() error: %v", err)
+			}
+			var models []string
+			for _, u := range reply.Usage {
+				models = append(models, u.Model)
+			}
+			if strings.Join(models, ",") != strings.Join(tt.wantModels, ",") {
+				t.Fatalf("usage models = %q, want %q", models, tt.wantModels)
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"chatgpt-telegram-bot/internal/domain"
+)
+
+var ErrToolExists = errors.New("tool already registered")
+
+// defaultToolMaxIterations applies when no positive limit is configured.
+const defaultToolMaxIterations = 5
+
+// ToolDefinition describes a function the model may call. Parameters is a
+// JSON schema object.
+type ToolDefinition struct {
+	Name        string
+	Description string
+	Parameters  json.RawMessage
+}
+
+// ToolCall is a function invocation requested by the model.
+type ToolCall struct {
+	ID        string
+	Name      string
+	Arguments string
+}
+
+type ToolHandler func(ctx context.Context, args json.RawMessage) (string, error)
+
+type Tool struct {
+	Definition ToolDefinition
+	Handler    ToolHandler
+}
+
+type ToolRegistry struct {
+	tools map[string]Tool
+	order []string
+}
+
+func NewToolRegistry() *ToolRegistry {
+	return &ToolRegistry{
+		tools: make(map[string]Tool),
+	}
+}
+
+func (r *ToolRegistry) Register(tool Tool) error {
+	name := tool.Definition.Name
+	if name == "" || tool.Handler == nil {
+		return errors.New("tool needs a name and a handler")
+	}
+	if !json.Valid(tool.Definition.Parameters) {
+		return fmt.Errorf("tool %s: parameters must be a json schema", name)
+	}
+	if _, ok := r.tools[name]; ok {
+		return fmt.Errorf("%w: %s", ErrToolExists, name)
+	}
+	r.tools[name] = tool
+	r.order = append(r.order, name)
+	return nil
+}
+
+// Definitions lists registered tools in registration order.
+func (r *ToolRegistry) Definitions() []ToolDefinition {
+	if r == nil {
+		return nil
+	}
+	defs := make([]ToolDefinition, 0, len(r.order))
+	for _, name := range r.order {
+		defs = append(defs, r.tools[name].Definition)
+	}
+	return defs
+}
+
+// Call runs a tool call and returns the text fed back to the model. Failures
+// are reported to the model rather than aborting the conversation.
+func (r *ToolRegistry) Call(ctx context.Context, call ToolCall) string {
+	tool, ok := r.tools[call.Name]
+	if !ok {
+		return fmt.Sprintf("error: unknown tool %q", call.Name)
+	}
+
+	args := json.RawMessage(strings.TrimSpace(call.Arguments))
+	if len(args) == 0 {
+		args = json.RawMessage("{}")
+	}
+	if !json.Valid(args) {
+		return "error: arguments are not valid json"
+	}
+
+	result, err := tool.Handler(ctx, args)
+	if err != nil {
+		log.Printf("tool %s failed: %v", call.Name, err)
+		return "error: " + err.Error()
+	}
+	return result
+}
+
+// complete runs the request, executing tool calls and feeding their results
+// back until the model answers with text or the iteration limit is reached.
+// When onDelta is set the reply is streamed through it.
+func (s *Service) complete(ctx context.Context, req CompletionRequest, onDelta func(string) error) (Completion, error) {
+	req.Tools = s.tools.Definitions()
+
+	var (
+		text  strings.Builder
+		usage = Usage{Model: req.Model}
+	)
+	maxIterations := s.cfg.ToolMaxIterations
+	if maxIterations <= 0 {
+		maxIterations = defaultToolMaxIterations
+	}
+	for iteration := 0; ; iteration++ {
+		if len(req.Tools) > 0 && iteration >= maxIterations {
+			// out of tool rounds: make the model answer with what it has
+			req.ToolChoice = ToolChoiceNone
+		}
+
+		resp, err := s.call(ctx, req, onDelta)
+		if err != nil {
+			return Completion{}, err
+		}
+		text.WriteString(resp.Text)
+		if resp.Usage.Model != "" {
+			// a failover may have answered with another model
+			usage.Model = resp.Usage.Model
+		}
+		usage.PromptTokens += resp.Usage.PromptTokens
+		usage.CompletionTokens += resp.Usage.CompletionTokens
+
+		if len(resp.ToolCalls) == 0 || req.ToolChoice == ToolChoiceNone {
+			resp.Text = text.String()
+			resp.ToolCalls = nil
+			resp.Usage = usage
+			return resp, nil
+		}
+
+		req.Messages = append(req.Messages, Message{
+			Role:      domain.RoleAssistant,
+			Text:      resp.Text,
+			ToolCalls: resp.ToolCalls,
+		})
+		for _, call := range resp.ToolCalls {
+			req.Messages = append(req.Messages, Message{
+				Role:       domain.RoleTool,
+				Text:       s.tools.Call(ctx, call),
+				ToolCallID: call.ID,
+			})
+		}
+	}
+}
+
+func (s *Service) call(ctx context.Context, req CompletionRequest, onDelta func(string) error) (Completion, error) {
+	if onDelta == nil {
+		return s.client.Complete(ctx, req)
+	}
+	if streamer, ok := s.client.(StreamingClient); ok {
+		return streamer.CompleteStream(ctx, req, onDelta)
+	}
+	resp, err := s.client.Complete(ctx, req)
+	if err != nil {
+		return Completion{}, err
+	}
+	if resp.Text != "" {
+		if err := onDelta(resp.Text); err != nil {
+			return Completion{}, err
+		}
+	}
+	return resp, nil
+}
@@ -0,0 +1,197 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"chatgpt-telegram-bot/internal/config"
+	"chatgpt-telegram-bot/internal/domain"
+)
+
+var emptySchema = json.RawMessage(`{"type": "object"}`)
+
+func echoTool(name string) Tool {
+	return Tool{
+		Definition: ToolDefinition{Name: name, Parameters: emptySchema},
+		Handler: func(_ context.Context, args json.RawMessage) (string, error) {
+			return string(args), nil
+		},
+	}
+}
+
+func TestToolRegistryRegister(t *testing.T) {
+	tests := []struct {
+		name    string
+		tool    Tool
+		wantErr bool
+	}{
+		{"valid", echoTool("echo"), false},
+		{"duplicate", echoTool("first"), true},
+		{"no name", echoTool(""), true},
+		{"no handler", Tool{Definition: ToolDefinition{Name: "nil", Parameters: emptySchema}}, true},
+		{"bad schema", Tool{
+			Definition: ToolDefinition{Name: "bad", Parameters: json.RawMessage(`{`)},
+			Handler:    echoTool("bad").Handler,
+		}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewToolRegistry()
+			if err := r.Register(echoTool("first")); err != nil {
+				t.Fatalf("Register(first) error: %v", err)
+			}
+			err := r.Register(tt.tool)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Register() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	r := NewToolRegistry()
+	r.Register(echoTool("echo"))
+	if err := r.Register(echoTool("echo")); !errors.Is(err, ErrToolExists) {
+		t.Fatalf("Register(duplicate) error = %v, want %v", err, ErrToolExists)
+	}
+}
+
+func TestToolRegistryDefinitionsKeepOrder(t *testing.T) {
+	r := NewToolRegistry()
+	for _, name := range []string{"b", "a", "c"} {
+		if err := r.Register(echoTool(name)); err != nil {
+			t.Fatalf("Register(%s) error: %v", name, err)
+		}
+	}
+
+	defs := r.Definitions()
+	if len(defs) != 3 || defs[0].Name != "b" || defs[1].Name != "a" || defs[2].Name != "c" {
+		t.Fatalf("Definitions() = %+v, want b, a, c", defs)
+	}
+	if defs := (*ToolRegistry)(nil).Definitions(); defs != nil {
+		t.Fatalf("nil registry Definitions() = %+v, want nil", defs)
+	}
+}
+
+func TestToolRegistryCall(t *testing.T) {
+	r := NewToolRegistry()
+	r.Register(echoTool("echo"))
+	r.Register(Tool{
+		Definition: ToolDefinition{Name: "fail", Parameters: emptySchema},
+		Handler: func(context.Context, json.RawMessage) (string, error) {
+			return "", errors.New("boom")
+		},
+	})
+
+	tests := []struct {
+		name string
+		call ToolCall
+		want string
+	}{
+		{"arguments", ToolCall{Name: "echo", Arguments: `{"x": 1}`}, `{"x": 1}`},
+		{"empty arguments", ToolCall{Name: "echo", Arguments: " "}, "{}"},
+		{"invalid arguments", ToolCall{Name: "echo", Arguments: "{"}, "error: arguments are not valid json"},
+		{"unknown tool", ToolCall{Name: "missing"}, `error: unknown tool "missing"`},
+		{"handler error", ToolCall{Name: "fail"}, "error: boom"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := r.Call(context.Background(), tt.call); got != tt.want {
+				t.Fatalf("Call() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// toolClient asks for the echo tool until tool calls are forbidden or it has
+// seen a tool result.
+type toolClient struct {
+	requests []CompletionRequest
+	always   bool
+}
+
+func (c *toolClient) Complete(_ context.Context, req CompletionRequest) (Completion, error) {
+	c.requests = append(c.requests, req)
+	last := req.Messages[len(req.Messages)-1]
+	if req.ToolChoice == ToolChoiceNone || (!c.always && last.Role == domain.RoleTool) {
+		return Completion{Text: "done"}, nil
+	}
+	return Completion{ToolCalls: []ToolCall{{ID: "call-1", Name: "echo", Arguments: `{"n": 1}`}}}, nil
+}
+
+func newToolService(t *testing.T, client Client, maxIterations int) *Service {
+	t.Helper()
+	r := NewToolRegistry()
+	if err := r.Register(echoTool("echo")); err != nil {
+		t.Fatalf("Register() error: %v", err)
+	}
+	s := newTestService(client, config.Config{ToolMaxIterations: maxIterations})
+	s.tools = r
+	return s
+}
+
+func TestCompleteFeedsToolResultsBack(t *testing.T) {
+	client := &toolClient{}
+	s := newToolService(t, client, 5)
+
+	req := CompletionRequest{Messages: []Message{{Role: domain.RoleUser, Text: "hi"}}}
+	resp, err := s.complete(context.Background(), req, nil)
+	if err != nil {
+		t.Fatalf("complete() error: %v", err)
+	}
+	if resp.Text != "done" || resp.ToolCalls != nil {
+		t.Fatalf("complete() = %+v, want the final text", resp)
+	}
+	if len(client.requests) != 2 {
+		t.Fatalf("client got %d requests, want 2", len(client.requests))
+	}
+
+	msgs := client.requests[1].Messages
+	if len(msgs) != 3 {
+		t.Fatalf("second request carried %d messages, want user, tool call and result", len(msgs))
+	}
+	if call := msgs[1]; call.Role != domain.RoleAssistant || len(call.ToolCalls) != 1 {
+		t.Fatalf("messages[1] = %+v, want the assistant tool call", call)
+	}
+	if result := msgs[2]; result.Role != domain.RoleTool || result.ToolCallID != "call-1" || result.Text != `{"n": 1}` {
+		t.Fatalf("messages[2] = %+v, want the echo result", result)
+	}
+}
+
+func TestCompleteCapsToolIterations(t *testing.T) {
+	tests := []struct {
+		name          string
+		maxIterations int
+		wantRequests  int
+	}{
+		{"configured", 2, 3},
+		{"unset uses default", 0, defaultToolMaxIterations + 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &toolClient{always: true}
+			s := newToolService(t, client, tt.maxIterations)
+
+			req := CompletionRequest{Messages: []Message{{Role: domain.RoleUser, Text: "hi"}}}
+			resp, err := s.complete(context.Background(), req, nil)
+			if err != nil {
+				t.Fatalf("complete() error: %v", err)
+			}
+			if resp.Text != "done" {
+				t.Fatalf("complete() text = %q, want done", resp.Text)
+			}
+			if len(client.requests) != tt.wantRequests {
+				t.Fatalf("client got %d requests, want %d", len(client.requests), tt.wantRequests)
+			}
+			for i, r := range client.requests {
+				last := i == len(client.requests)-1
+				if (r.ToolChoice == ToolChoiceNone) != last {
+					t.Fatalf("request %d tool choice = %q, want none only on the last request", i, r.ToolChoice)
+				}
+				if len(r.Tools) != 1 {
+					t.Fatalf("request %d carried %d tools, want 1", i, len(r.Tools))
+				}
+			}
+		})
+	}
+}
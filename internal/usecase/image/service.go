@@ -8,7 +8,10 @@ import (
 	"chatgpt-telegram-bot/internal/config"
 )
 
-var ErrEmptyPrompt = errors.New("empty prompt")
+var (
+	ErrEmptyPrompt = errors.New("empty prompt")
+	ErrNoImage     = errors.New("no image to edit")
+)
 
 type Client interface {
 	Generate(ctx context.Context, req Request) (Response, error)
@@ -21,6 +24,11 @@ type Request struct {
 	Quality    string
 	Format     string
 	Background string
+	// Images are data URLs of pictures to edit or draw from. Mask is a data
+	// URL of a PNG whose transparent areas mark what to redraw in the first
+	// image.
+	Images []string
+	Mask   string
 }
 
 type Response struct {
@@ -45,12 +53,32 @@ func (s *Service) Generate(ctx context.Context, prompt string) (Response, error)
 		return Response{}, ErrEmptyPrompt
 	}
 
-	return s.client.Generate(ctx, Request{
+	return s.client.Generate(ctx, s.request(prompt))
+}
+
+// Edit changes images as prompt describes. With a mask only its transparent
+// areas of the first image are redrawn.
+func (s *Service) Edit(ctx context.Context, prompt string, images []string, mask string) (Response, error) {
+	if strings.TrimSpace(prompt) == "" {
+		return Response{}, ErrEmptyPrompt
+	}
+	if len(images) == 0 {
+		return Response{}, ErrNoImage
+	}
+
+	req := s.request(prompt)
+	req.Images = images
+	req.Mask = mask
+	return s.client.Generate(ctx, req)
+}
+
+func (s *Service) request(prompt string) Request {
+	return Request{
 		Model:      s.cfg.ImageModel,
 		Prompt:     prompt,
 		Size:       s.cfg.ImageSize,
 		Quality:    s.cfg.ImageQuality,
 		Format:     s.cfg.ImageFormat,
 		Background: s.cfg.ImageBackground,
-	})
+	}
 }
@@ -0,0 +1,36 @@
+package quota
+
+import "time"
+
+// bucket is a token bucket that refills perMinute tokens a minute up to burst.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newBucket(burst int, now time.Time) *bucket {
+	return &bucket{tokens: float64(burst), last: now}
+}
+
+func (b *bucket) refill(now time.Time, perMinute, burst int) {
+	elapsed := now.Sub(b.last)
+	if elapsed > 0 {
+		b.tokens += elapsed.Minutes() * float64(perMinute)
+		b.last = now
+	}
+	if b.tokens > float64(burst) {
+		b.tokens = float64(burst)
+	}
+}
+
+// wait returns how long until a token is available; zero means one is available now.
+func (b *bucket) wait(perMinute int) time.Duration {
+	if b.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / float64(perMinute) * float64(time.Minute))
+}
+
+func (b *bucket) full(burst int) bool {
+	return b.tokens >= float64(burst)
+}
@@ -0,0 +1,159 @@
+package quota
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"chatgpt-telegram-bot/internal/config"
+)
+
+type Limit int
+
+const (
+	LimitUserRate Limit = iota + 1
+	LimitChatRate
+	LimitDailyRequests
+	LimitDailyImages
+	LimitDailyTTSChars
+)
+
+// LimitError reports which limit a request hit and when it frees up again.
+type LimitError struct {
+	Limit   Limit
+	ResetAt time.Time
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("limit %d reached until %s", e.Limit, e.ResetAt.Format(time.RFC3339))
+}
+
+// Request describes what a single bot request is about to spend.
+type Request struct {
+	Images   int
+	TTSChars int
+}
+
+type daily struct {
+	requests int
+	images   int
+	ttsChars int
+}
+
+// Service enforces per-user and per-chat rate limits and per-user daily
+// caps. State is kept in memory and daily counters reset at local midnight.
+type Service struct {
+	cfg config.Config
+	now func() time.Time
+
+	mu    sync.Mutex
+	day   time.Time
+	users map[int64]*bucket
+	chats map[int64]*bucket
+	spent map[int64]*daily
+}
+
+func NewService(cfg config.Config) *Service {
+	return &Service{
+		cfg:   cfg,
+		now:   time.Now,
+		users: make(map[int64]*bucket),
+		chats: make(map[int64]*bucket),
+		spent: make(map[int64]*daily),
+	}
+}
+
+// Allow checks the request against every limit and, when it passes, charges
+// it. Admins are never limited. A rejected request is not charged.
+func (s *Service) Allow(userID, chatID int64, req Request) error {
+	if slices.Contains(s.cfg.AdminUserIDs, userID) {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.rollover(now)
+	tomorrow := s.day.AddDate(0, 0, 1)
+
+	used := s.spent[userID]
+	if used == nil {
+		used = &daily{}
+	}
+	if exceeds(used.requests, 1, s.cfg.DailyRequestLimit) {
+		return &LimitError{Limit: LimitDailyRequests, ResetAt: tomorrow}
+	}
+	if exceeds(used.images, req.Images, s.cfg.DailyImageLimit) {
+		return &LimitError{Limit: LimitDailyImages, ResetAt: tomorrow}
+	}
+	if exceeds(used.ttsChars, req.TTSChars, s.cfg.DailyTTSCharLimit) {
+		return &LimitError{Limit: LimitDailyTTSChars, ResetAt: tomorrow}
+	}
+
+	user := s.bucket(s.users, userID, s.cfg.UserRatePerMinute, s.cfg.UserRateBurst, now)
+	if user != nil {
+		if wait := user.wait(s.cfg.UserRatePerMinute); wait > 0 {
+			return &LimitError{Limit: LimitUserRate, ResetAt: now.Add(wait)}
+		}
+	}
+	chat := s.bucket(s.chats, chatID, s.cfg.ChatRatePerMinute, s.cfg.ChatRateBurst, now)
+	if chat != nil {
+		if wait := chat.wait(s.cfg.ChatRatePerMinute); wait > 0 {
+			return &LimitError{Limit: LimitChatRate, ResetAt: now.Add(wait)}
+		}
+	}
+
+	if user != nil {
+		user.tokens--
+	}
+	if chat != nil {
+		chat.tokens--
+	}
+	used.requests++
+	used.images += req.Images
+	used.ttsChars += req.TTSChars
+	s.spent[userID] = used
+	return nil
+}
+
+// bucket returns the refilled bucket for id, or nil when the limit is disabled.
+func (s *Service) bucket(buckets map[int64]*bucket, id int64, perMinute, burst int, now time.Time) *bucket {
+	if perMinute <= 0 || burst <= 0 {
+		return nil
+	}
+	b, ok := buckets[id]
+	if !ok {
+		b = newBucket(burst, now)
+		buckets[id] = b
+	}
+	b.refill(now, perMinute, burst)
+	return b
+}
+
+// rollover resets daily counters on a new day and drops idle buckets so the
+// maps do not grow with every user the bot has ever seen.
+func (s *Service) rollover(now time.Time) {
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	if day.Equal(s.day) {
+		return
+	}
+	s.day = day
+	clear(s.spent)
+	prune(s.users, now, s.cfg.UserRatePerMinute, s.cfg.UserRateBurst)
+	prune(s.chats, now, s.cfg.ChatRatePerMinute, s.cfg.ChatRateBurst)
+}
+
+func prune(buckets map[int64]*bucket, now time.Time, perMinute, burst int) {
+	for id, b := range buckets {
+		b.refill(now, perMinute, burst)
+		if b.full(burst) {
+			delete(buckets, id)
+		}
+	}
+}
+
+func exceeds(used, add, limit int) bool {
+	return limit > 0 && add > 0 && used+add > limit
+}
@@ -0,0 +1,58 @@
+package transcribe
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"chatgpt-telegram-bot/internal/config"
+)
+
+var (
+	ErrEmptyAudio = errors.New("empty audio")
+	ErrTooLong    = errors.New("audio is too long to transcribe")
+)
+
+type Client interface {
+	Transcribe(ctx context.Context, req Request) (string, error)
+}
+
+type Request struct {
+	Model    string
+	Language string
+	FileName string
+	Data     []byte
+}
+
+type Service struct {
+	client Client
+	cfg    config.Config
+}
+
+func NewService(client Client, cfg config.Config) *Service {
+	return &Service{
+		client: client,
+		cfg:    cfg,
+	}
+}
+
+// Allowed reports whether audio of the given duration may be transcribed.
+func (s *Service) Allowed(duration time.Duration) bool {
+	return s.cfg.TranscribeMaxDuration <= 0 || duration <= s.cfg.TranscribeMaxDuration
+}
+
+func (s *Service) Transcribe(ctx context.Context, fileName string, data []byte, duration time.Duration) (string, error) {
+	if len(data) == 0 {
+		return "", ErrEmptyAudio
+	}
+	if !s.Allowed(duration) {
+		return "", ErrTooLong
+	}
+
+	return s.client.Transcribe(ctx, Request{
+		Model:    s.cfg.TranscribeModel,
+		Language: s.cfg.TranscribeLanguage,
+		FileName: fileName,
+		Data:     data,
+	})
+}
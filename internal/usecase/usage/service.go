@@ -0,0 +1,94 @@
+package usage
+
+import (
+	"time"
+
+	"chatgpt-telegram-bot/internal/config"
+	"chatgpt-telegram-bot/internal/domain"
+)
+
+const topUsersLimit = 10
+
+type Service struct {
+	ledger domain.UsageLedger
+	cfg    config.Config
+	now    func() time.Time
+}
+
+func NewService(ledger domain.UsageLedger, cfg config.Config) *Service {
+	return &Service{
+		ledger: ledger,
+		cfg:    cfg,
+		now:    time.Now,
+	}
+}
+
+func (s *Service) RecordChat(userID, chatID int64, model string, promptTokens, completionTokens int) {
+	price := s.cfg.Prices[model]
+	s.ledger.Record(domain.UsageRecord{
+		UserID:           userID,
+		ChatID:           chatID,
+		Kind:             domain.UsageChat,
+		Model:            model,
+		PromptTokens:     promptTokens,
+		CompletionTokens: completionTokens,
+		Cost: float64(promptTokens)*price.InputPer1M/1e6 +
+			float64(completionTokens)*price.OutputPer1M/1e6,
+		Timestamp: s.now(),
+	})
+}
+
+func (s *Service) RecordTTS(userID, chatID int64, model string, chars int) {
+	s.ledger.Record(domain.UsageRecord{
+		UserID:    userID,
+		ChatID:    chatID,
+		Kind:      domain.UsageTTS,
+		Model:     model,
+		TTSChars:  chars,
+		Cost:      float64(chars) * s.cfg.Prices[model].CharsPer1M / 1e6,
+		Timestamp: s.now(),
+	})
+}
+
+func (s *Service) RecordImage(userID, chatID int64, model string, images int) {
+	s.ledger.Record(domain.UsageRecord{
+		UserID:    userID,
+		ChatID:    chatID,
+		Kind:      domain.UsageImage,
+		Model:     model,
+		Images:    images,
+		Cost:      float64(images) * s.cfg.Prices[model].PerImage,
+		Timestamp: s.now(),
+	})
+}
+
+type Report struct {
+	Today domain.UsageTotals
+	Month domain.UsageTotals
+}
+
+// UserReport sums a user's usage for the current day and month.
+func (s *Service) UserReport(userID int64) Report {
+	day, month := s.periods()
+	return Report{
+		Today: s.ledger.Totals(domain.UsageFilter{UserID: userID, Since: day}),
+		Month: s.ledger.Totals(domain.UsageFilter{UserID: userID, Since: month}),
+	}
+}
+
+// GlobalReport sums all usage for the current day and month and lists the
+// heaviest users of the month.
+func (s *Service) GlobalReport() (Report, []domain.UserUsage) {
+	day, month := s.periods()
+	return Report{
+		Today: s.ledger.Totals(domain.UsageFilter{Since: day}),
+		Month: s.ledger.Totals(domain.UsageFilter{Since: month}),
+	}, s.ledger.TopUsers(month, topUsersLimit)
+}
+
+func (s *Service) periods() (time.Time, time.Time) {
+	now := s.now()
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	return day, month
+}